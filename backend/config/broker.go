@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"gotest/pkg/broker"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Broker 聊天消息的跨实例总线，InitBroker 之后可用
+var Broker broker.Broker
+
+// InitBroker 按环境变量选择消息总线
+// BROKER_DRIVER=memory (默认) 为单实例模式；多实例部署时设为 redis，各实例连接同一个 Redis：
+// REDIS_ADDR (默认 127.0.0.1:6379) / REDIS_PASSWORD / REDIS_DB / REDIS_PREFIX (默认 xianqu)
+// NODE_ID 为实例 ID (默认 主机名-进程号)，NODE_TTL_SECONDS 为实例心跳过期时间 (默认 30 秒)
+func InitBroker() {
+	cfg := broker.Config{
+		Driver:        os.Getenv("BROKER_DRIVER"),
+		NodeID:        os.Getenv("NODE_ID"),
+		RedisAddr:     os.Getenv("REDIS_ADDR"),
+		RedisPassword: os.Getenv("REDIS_PASSWORD"),
+		RedisPrefix:   os.Getenv("REDIS_PREFIX"),
+	}
+	if n, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		cfg.RedisDB = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("NODE_TTL_SECONDS")); err == nil && n > 0 {
+		cfg.NodeTTL = time.Duration(n) * time.Second
+	}
+
+	var err error
+	Broker, err = broker.New(cfg)
+	if err != nil {
+		log.Fatal("❌ 消息总线初始化失败: ", err)
+	}
+
+	if cfg.Driver == "redis" {
+		fmt.Println("✅ 消息总线: Redis", cfg.RedisAddr, "实例:", Broker.NodeID())
+	} else {
+		fmt.Println("✅ 消息总线: 单实例")
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// ChatSettings 聊天相关配置，可通过环境变量覆盖
+type ChatSettings struct {
+	RecallWindow time.Duration // 发送后多久内可以撤回，CHAT_RECALL_WINDOW_MINUTES，默认 2 分钟
+
+	MaxTextLength  int // 文字消息最大字数，CHAT_MAX_TEXT_LENGTH，默认 1000
+	MaxImageURLLen int // 图片消息地址最大长度 (字节)，默认 512
+
+	// 限流 (令牌桶)：每秒/每分钟补充的次数和允许的突发次数，设为 0 关闭
+	ConnFramesPerSecond   float64 // 单个连接每秒可发送的帧数 (所有类型)，CHAT_CONN_RATE，默认 5
+	ConnBurst             int     // CHAT_CONN_BURST，默认 20
+	UserMessagesPerMinute float64 // 同一用户所有设备每分钟可发送的聊天消息数，CHAT_USER_RATE_PER_MINUTE，默认 60
+	UserBurst             int     // CHAT_USER_BURST，默认 10
+}
+
+var Chat = loadChatSettings()
+
+func loadChatSettings() ChatSettings {
+	s := ChatSettings{
+		RecallWindow:          2 * time.Minute,
+		MaxTextLength:         1000,
+		MaxImageURLLen:        512,
+		ConnFramesPerSecond:   5,
+		ConnBurst:             20,
+		UserMessagesPerMinute: 60,
+		UserBurst:             10,
+	}
+
+	if m, err := strconv.Atoi(os.Getenv("CHAT_RECALL_WINDOW_MINUTES")); err == nil && m > 0 {
+		s.RecallWindow = time.Duration(m) * time.Minute
+	}
+	if n, err := strconv.Atoi(os.Getenv("CHAT_MAX_TEXT_LENGTH")); err == nil && n > 0 {
+		s.MaxTextLength = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("CHAT_CONN_RATE"), 64); err == nil && f >= 0 {
+		s.ConnFramesPerSecond = f
+	}
+	if n, err := strconv.Atoi(os.Getenv("CHAT_CONN_BURST")); err == nil && n > 0 {
+		s.ConnBurst = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("CHAT_USER_RATE_PER_MINUTE"), 64); err == nil && f >= 0 {
+		s.UserMessagesPerMinute = f
+	}
+	if n, err := strconv.Atoi(os.Getenv("CHAT_USER_BURST")); err == nil && n > 0 {
+		s.UserBurst = n
+	}
+	return s
+}
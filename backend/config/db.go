@@ -65,6 +65,18 @@ func InitDB() {
 		&models.Cart{},     // <--- ★★★ 这里！把前面的 // 去掉，启用购物车表
 		&models.Favorite{}, // 收藏表如果写了，也可以去掉注释
 		&models.Message{},
+		&models.Checkout{},
+		&models.Notification{},
+		&models.Category{},
+		&models.Upload{},
+		&models.ProductImage{},
+		&models.Conversation{},
+		&models.MessageDeletion{},
+		&models.UserBlock{},
+		&models.ProductView{},
+		&models.ModerationRule{},
+		&models.ModerationFlag{},
+		&models.OrderItem{},
 	)
 
 	if err != nil {
@@ -72,4 +84,10 @@ func InitDB() {
 	}
 
 	fmt.Println("✅ 数据库表结构已同步完成")
+
+	// 7. 数据迁移 (补全历史数据)
+	runDataMigrations()
+
+	// 8. 商品全文索引
+	initSearchIndex()
 }
@@ -0,0 +1,383 @@
+package config
+
+import (
+	"fmt"
+	"gotest/internal/models"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// runDataMigrations 在 AutoMigrate 之后执行的数据迁移 (均可重复执行)
+func runDataMigrations() {
+	backfillOrderSnapshots()
+	backfillCartPrices()
+	backfillFavoritePrices()
+	migrateCategories()
+	uniqueCategoryNames()
+	backfillProductImages()
+	rewriteUploadURLs()
+	moveChatImagesPrivate()
+	backfillUploadPurposes()
+	backfillConversations()
+	seedModerationRules()
+	uniqueClientMsgIDs()
+}
+
+// backfillOrderSnapshots 为没有快照的历史订单补全商品快照
+// 快照价格取订单的成交价，商品之后改过价也不受影响；商品已被删除的订单查不到数据，保持为空
+func backfillOrderSnapshots() {
+	result := DB.Exec(`
+		UPDATE orders SET
+			snapshot_name = (SELECT name FROM products WHERE products.id = orders.product_id),
+			snapshot_description = (SELECT description FROM products WHERE products.id = orders.product_id),
+			snapshot_image = (SELECT image FROM products WHERE products.id = orders.product_id),
+			snapshot_price = orders.price,
+			snapshot_category = (SELECT category FROM products WHERE products.id = orders.product_id),
+			snapshot_seller_nickname = (SELECT COALESCE(NULLIF(nickname, ''), username) FROM users WHERE users.id = orders.seller_id)
+		WHERE (snapshot_name IS NULL OR snapshot_name = '')
+			AND EXISTS (SELECT 1 FROM products WHERE products.id = orders.product_id)`)
+	if result.Error != nil {
+		fmt.Println("⚠️ 订单快照补全失败:", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("✅ 已为 %d 个历史订单补全商品快照\n", result.RowsAffected)
+	}
+}
+
+// backfillCartPrices 旧的购物车条目没有记录加入时价格，按商品当前价格补全
+func backfillCartPrices() {
+	result := DB.Exec(`
+		UPDATE carts SET added_price = (SELECT price FROM products WHERE products.id = carts.product_id)
+		WHERE (added_price IS NULL OR added_price = 0)
+			AND EXISTS (SELECT 1 FROM products WHERE products.id = carts.product_id)`)
+	if result.Error != nil {
+		fmt.Println("⚠️ 购物车价格补全失败:", result.Error)
+	}
+}
+
+// backfillFavoritePrices 旧的收藏没有记录收藏时价格，按商品当前价格补全
+func backfillFavoritePrices() {
+	result := DB.Exec(`
+		UPDATE favorites SET favorited_price = (SELECT price FROM products WHERE products.id = favorites.product_id)
+		WHERE (favorited_price IS NULL OR favorited_price = 0)
+			AND EXISTS (SELECT 1 FROM products WHERE products.id = favorites.product_id)`)
+	if result.Error != nil {
+		fmt.Println("⚠️ 收藏价格补全失败:", result.Error)
+	}
+}
+
+// 初始分类 (原先硬编码在 ProductController.Categories 中)
+var defaultCategories = []string{"数码", "书籍", "生活", "服饰", "运动", "美妆", "乐器", "手游", "兼职", "其他"}
+
+// migrateCategories 初始化分类表，并把商品上的自由文本分类映射为分类 ID
+// 1. 分类表为空时写入默认分类
+// 2. 空分类归入「其他」，商品中出现过、但分类表里没有的名称补建为一级分类
+// 3. 按名称回填 category_id
+func migrateCategories() {
+	var count int64
+	DB.Model(&models.Category{}).Count(&count)
+	if count == 0 {
+		for i, name := range defaultCategories {
+			DB.Create(&models.Category{Name: name, SortOrder: i + 1, Enabled: true})
+		}
+		fmt.Println("✅ 已初始化默认商品分类")
+	}
+
+	DB.Exec("UPDATE products SET category = ? WHERE category_id = 0 AND (category IS NULL OR category = '')", "其他")
+
+	var names []string
+	DB.Model(&models.Product{}).
+		Where("category_id = 0 AND category NOT IN (SELECT name FROM categories)").
+		Distinct().Pluck("category", &names)
+	for _, name := range names {
+		DB.Create(&models.Category{Name: name, SortOrder: 100, Enabled: true})
+	}
+	result := DB.Exec(`
+		UPDATE products SET category_id = (SELECT MIN(id) FROM categories WHERE categories.name = products.category)
+		WHERE category_id = 0 AND EXISTS (SELECT 1 FROM categories WHERE categories.name = products.category)`)
+	if result.Error != nil {
+		fmt.Println("⚠️ 商品分类迁移失败:", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("✅ 已为 %d 个商品关联分类\n", result.RowsAffected)
+	}
+}
+
+// uniqueCategoryNames 为 (parent_id, name) 建唯一索引，同一父分类下不允许重名
+// 建索引前把历史数据中重名的分类改名为「名称-ID」(保留最早一条)，并同步商品上冗余的分类名
+func uniqueCategoryNames() {
+	DB.Exec(`
+		UPDATE categories SET name = name || '-' || id
+		WHERE EXISTS (
+			SELECT 1 FROM categories AS c
+			WHERE c.parent_id = categories.parent_id AND c.name = categories.name AND c.id < categories.id
+		)`)
+	DB.Exec(`
+		UPDATE products SET category = (SELECT name FROM categories WHERE categories.id = products.category_id)
+		WHERE category_id <> 0 AND category <> (SELECT name FROM categories WHERE categories.id = products.category_id)`)
+	err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_parent_name ON categories (parent_id, name)").Error
+	if err != nil {
+		fmt.Println("⚠️ 分类名称唯一索引创建失败:", err)
+	}
+}
+
+// backfillProductImages 旧商品只有一张 image，迁移为一条封面图片记录
+func backfillProductImages() {
+	result := DB.Exec(`
+		INSERT INTO product_images (created_at, product_id, upload_id, url, sort_order, width, height, is_cover)
+		SELECT created_at, id, 0, image, 0, 0, 0, 1 FROM products
+		WHERE image IS NOT NULL AND image != ''
+			AND NOT EXISTS (SELECT 1 FROM product_images WHERE product_images.product_id = products.id)`)
+	if result.Error != nil {
+		fmt.Println("⚠️ 商品图片迁移失败:", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("✅ 已为 %d 个商品迁移封面图片\n", result.RowsAffected)
+	}
+}
+
+// 本服务生成的上传文件名：纳秒时间戳 (+ _缩略图尺寸) + 扩展名
+var uploadKeyPattern = regexp.MustCompile(`^\d+(_\d+)?\.[A-Za-z0-9]+$`)
+
+// 保存了上传文件地址的字段
+var uploadURLColumns = []struct {
+	table, column, where string
+}{
+	{"products", "image", ""},
+	{"product_images", "url", ""},
+	{"users", "avatar", ""},
+	{"messages", "content", "type = 2"},
+	{"uploads", "url", ""},
+	{"orders", "snapshot_image", ""},
+}
+
+// rewriteUploadURLs 旧的上传接口按请求域名生成绝对地址 (如 http://localhost:8081/uploads/xxx.jpg)，
+// 换了域名/IP 就无法访问；统一改写为存储当前配置的地址 (默认相对路径 /uploads/xxx.jpg)
+// 使用 S3 驱动时需先把本地 uploads 目录同步到存储桶
+func rewriteUploadURLs() {
+	total := 0
+	for _, col := range uploadURLColumns {
+		var rows []struct {
+			ID    uint
+			Value string
+		}
+		q := DB.Table(col.table).Select("id, "+col.column+" AS value").Where(col.column+" LIKE ?", "%/uploads/%")
+		if col.where != "" {
+			q = q.Where(col.where)
+		}
+		if err := q.Scan(&rows).Error; err != nil {
+			fmt.Println("⚠️ 上传地址迁移失败:", col.table, err)
+			continue
+		}
+		for _, row := range rows {
+			newURL, ok := normalizeUploadURL(row.Value)
+			if !ok || newURL == row.Value {
+				continue
+			}
+			if err := DB.Table(col.table).Where("id = ?", row.ID).UpdateColumn(col.column, newURL).Error; err == nil {
+				total++
+			}
+		}
+	}
+	if total > 0 {
+		fmt.Printf("✅ 已将 %d 个上传文件地址改写为与域名无关的地址\n", total)
+	}
+}
+
+// normalizeUploadURL 把指向 /uploads/<key> 的地址改写为 Storage.URL(key)
+func normalizeUploadURL(raw string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || !strings.HasPrefix(u.Path, "/uploads/") {
+		return "", false
+	}
+	key := strings.TrimPrefix(u.Path, "/uploads/")
+	if !uploadKeyPattern.MatchString(key) {
+		return "", false
+	}
+	return Storage.URL(key), true
+}
+
+// moveChatImagesPrivate 旧的聊天图片保存在公开的 /uploads 下，迁移到私有存储并改为 /private/<key> 引用
+// 公开文件仍被商品或头像使用时保留，否则删除
+func moveChatImagesPrivate() {
+	var messages []models.Message
+	DB.Where("type = ? AND content NOT LIKE ?", 2, PrivatePrefix+"%").Find(&messages)
+
+	moved := 0
+	for _, msg := range messages {
+		u, err := url.Parse(msg.Content)
+		if err != nil || !strings.HasPrefix(u.Path, "/uploads/") {
+			continue
+		}
+		key := strings.TrimPrefix(u.Path, "/uploads/")
+		if !uploadKeyPattern.MatchString(key) {
+			continue
+		}
+
+		// 1. 复制到私有存储 (同一张图可能出现在多条消息里，已复制过则跳过)
+		if rc, _, err := PrivateStorage.Get(key); err == nil {
+			rc.Close()
+		} else {
+			rc, info, err := Storage.Get(key)
+			if err != nil {
+				continue
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || PrivateStorage.Put(key, data, info.ContentType) != nil {
+				continue
+			}
+		}
+
+		// 2. 改写消息引用
+		DB.Model(&models.Message{}).Where("id = ?", msg.ID).UpdateColumn("content", PrivatePrefix+key)
+		moved++
+
+		// 3. 没有上传记录、商品或头像引用时删除公开文件
+		var used int64
+		like := "%/uploads/" + key
+		DB.Model(&models.Upload{}).Where("storage_key = ? AND private = ?", key, false).Count(&used)
+		if used == 0 {
+			DB.Model(&models.Product{}).Where("image LIKE ?", like).Count(&used)
+		}
+		if used == 0 {
+			DB.Model(&models.ProductImage{}).Where("url LIKE ?", like).Count(&used)
+		}
+		if used == 0 {
+			DB.Model(&models.User{}).Where("avatar LIKE ?", like).Count(&used)
+		}
+		if used == 0 {
+			Storage.Delete(key)
+		}
+	}
+	if moved > 0 {
+		fmt.Printf("✅ 已将 %d 条聊天图片迁移到私有存储\n", moved)
+	}
+}
+
+// backfillUploadPurposes 历史上传记录没有用途：私有附件被图片消息引用的是聊天图片，其余视为纠纷凭证
+// (宁可多保留几张没发出去的聊天图片，也不能误删凭证)
+func backfillUploadPurposes() {
+	result := DB.Exec(`
+		UPDATE uploads SET purpose = CASE
+			WHEN EXISTS (SELECT 1 FROM messages WHERE messages.type = 2 AND messages.content = uploads.url) THEN ?
+			ELSE ? END
+		WHERE private = ? AND (purpose IS NULL OR purpose = '')`,
+		models.UploadPurposeChat, models.UploadPurposeEvidence, true)
+	if result.Error != nil {
+		fmt.Println("⚠️ 回填上传用途失败:", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("✅ 已回填 %d 条私有附件的用途\n", result.RowsAffected)
+	}
+}
+
+// 消息两端按 ID 从小到大排列，与 conversations.user_a_id / user_b_id 对应
+const (
+	messageUserA = "CASE WHEN messages.sender_id < messages.receiver_id THEN messages.sender_id ELSE messages.receiver_id END"
+	messageUserB = "CASE WHEN messages.sender_id < messages.receiver_id THEN messages.receiver_id ELSE messages.sender_id END"
+)
+
+// backfillConversations 历史消息没有会话，按两人建立普通私聊会话 (不关联商品)，
+// 回填消息的 conversation_id，并统计最后一条消息、未读数和已读位置
+func backfillConversations() {
+	result := DB.Exec(`
+		INSERT INTO conversations (created_at, updated_at, user_a_id, user_b_id, product_id)
+		SELECT first_at, last_at, user_a, user_b, 0 FROM (
+			SELECT ` + messageUserA + ` AS user_a, ` + messageUserB + ` AS user_b,
+				MIN(messages.created_at) AS first_at, MAX(messages.created_at) AS last_at
+			FROM messages WHERE messages.conversation_id = 0
+			GROUP BY user_a, user_b
+		) pairs
+		WHERE NOT EXISTS (SELECT 1 FROM conversations c
+			WHERE c.user_a_id = pairs.user_a AND c.user_b_id = pairs.user_b AND c.product_id = 0)`)
+	if result.Error != nil {
+		fmt.Println("⚠️ 会话迁移失败:", result.Error)
+		return
+	}
+
+	linked := DB.Exec(`
+		UPDATE messages SET conversation_id = (SELECT c.id FROM conversations c
+			WHERE c.user_a_id = ` + messageUserA + ` AND c.user_b_id = ` + messageUserB + ` AND c.product_id = 0)
+		WHERE conversation_id = 0`)
+	if linked.Error != nil {
+		fmt.Println("⚠️ 消息关联会话失败:", linked.Error)
+		return
+	}
+	if linked.RowsAffected == 0 {
+		return
+	}
+
+	// 只重新统计刚建立或刚补进消息的会话
+	last := "(SELECT MAX(id) FROM messages m WHERE m.conversation_id = conversations.id AND m.deleted_at IS NULL)"
+	summary := DB.Exec(`
+		UPDATE conversations SET
+			last_message_id = COALESCE(` + last + `, 0),
+			last_sender_id = COALESCE((SELECT sender_id FROM messages WHERE id = ` + last + `), 0),
+			last_message_type = COALESCE((SELECT type FROM messages WHERE id = ` + last + `), 0),
+			last_message = (SELECT content FROM messages WHERE id = ` + last + `),
+			last_message_at = (SELECT created_at FROM messages WHERE id = ` + last + `),
+			unread_a = (SELECT COUNT(*) FROM messages m WHERE m.conversation_id = conversations.id
+				AND m.receiver_id = conversations.user_a_id AND m.sender_id != m.receiver_id AND m.is_read = 0 AND m.deleted_at IS NULL),
+			unread_b = (SELECT COUNT(*) FROM messages m WHERE m.conversation_id = conversations.id
+				AND m.receiver_id = conversations.user_b_id AND m.sender_id != m.receiver_id AND m.is_read = 0 AND m.deleted_at IS NULL),
+			last_read_a = COALESCE((SELECT MAX(id) FROM messages m WHERE m.conversation_id = conversations.id
+				AND m.receiver_id = conversations.user_a_id AND m.is_read = 1), 0),
+			last_read_b = COALESCE((SELECT MAX(id) FROM messages m WHERE m.conversation_id = conversations.id
+				AND m.receiver_id = conversations.user_b_id AND m.is_read = 1), 0)
+		WHERE id IN (SELECT DISTINCT conversation_id FROM messages)
+			AND (last_message_id IS NULL OR last_message_id < ` + last + `)`)
+	if summary.Error != nil {
+		fmt.Println("⚠️ 会话统计失败:", summary.Error)
+		return
+	}
+	fmt.Printf("✅ 已为 %d 条历史消息建立会话\n", linked.RowsAffected)
+}
+
+// 初始过滤规则：校园二手常见的站外交易、诈骗话术，默认进入人工审核，管理员可在后台调整
+var defaultModerationRules = []models.ModerationRule{
+	{Pattern: "加微信", Action: "flag", Note: "引导站外交易"},
+	{Pattern: "加vx", Action: "flag", Note: "引导站外交易"},
+	{Pattern: "加qq", Action: "flag", Note: "引导站外交易"},
+	{Pattern: "线下转账", Action: "flag", Note: "绕过平台付款"},
+	{Pattern: "私下交易", Action: "flag", Note: "绕过平台付款"},
+	{Pattern: "先付定金", Action: "flag", Note: "预付诈骗"},
+	{Pattern: "刷单返利", Action: "block", Note: "刷单诈骗"},
+	{Pattern: `(微信|weixin|wx|vx|v信)号?[a-z][a-z0-9]{5,19}`, IsRegex: true, Action: "flag", Note: "微信号"},
+	{Pattern: `(qq|扣扣)号?[0-9]{5,11}`, IsRegex: true, Action: "flag", Note: "QQ 号"},
+}
+
+// seedModerationRules 规则表为空时写入初始规则
+func seedModerationRules() {
+	var count int64
+	DB.Model(&models.ModerationRule{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	for _, rule := range defaultModerationRules {
+		rule.Enabled = true
+		DB.Create(&rule)
+	}
+	fmt.Printf("✅ 已写入 %d 条初始内容过滤规则\n", len(defaultModerationRules))
+}
+
+// uniqueClientMsgIDs 为 (sender_id, client_msg_id) 建唯一索引 (只约束带帧 ID 的消息)，
+// 同一帧 ID 并发重发时由数据库保证只存一条；建索引前清掉历史数据中重复的帧 ID (保留最早一条)
+func uniqueClientMsgIDs() {
+	DB.Exec(`
+		UPDATE messages SET client_msg_id = ''
+		WHERE client_msg_id <> '' AND EXISTS (
+			SELECT 1 FROM messages AS m
+			WHERE m.sender_id = messages.sender_id AND m.client_msg_id = messages.client_msg_id AND m.id < messages.id
+		)`)
+	err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_client_msg ON messages (sender_id, client_msg_id) WHERE client_msg_id <> ''").Error
+	if err != nil {
+		fmt.Println("⚠️ 消息帧 ID 唯一索引创建失败:", err)
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import "fmt"
+
+// initSearchIndex 建立商品全文索引 (SQLite FTS5)
+// 使用 trigram 分词器：按三字切分，中英文混排都能匹配，不依赖空格分词
+// 索引为外部内容表，由触发器与 products 表保持同步
+func initSearchIndex() {
+	var count int64
+	DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'products_fts'").Scan(&count)
+	exists := count > 0
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS products_fts USING fts5(
+			name, description, content='products', content_rowid='id', tokenize='trigram')`,
+		`CREATE TRIGGER IF NOT EXISTS products_fts_insert AFTER INSERT ON products BEGIN
+			INSERT INTO products_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS products_fts_delete AFTER DELETE ON products BEGIN
+			INSERT INTO products_fts(products_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+		END`,
+		// 只在名称或描述变化时重建索引，浏览量等字段更新不触发
+		`CREATE TRIGGER IF NOT EXISTS products_fts_update AFTER UPDATE OF name, description ON products BEGIN
+			INSERT INTO products_fts(products_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+			INSERT INTO products_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+		END`,
+	}
+	for _, sql := range statements {
+		if err := DB.Exec(sql).Error; err != nil {
+			fmt.Println("⚠️ 全文索引初始化失败:", err)
+			return
+		}
+	}
+
+	// 首次建表时把已有商品导入索引
+	if !exists {
+		if err := DB.Exec("INSERT INTO products_fts(products_fts) VALUES ('rebuild')").Error; err != nil {
+			fmt.Println("⚠️ 全文索引重建失败:", err)
+			return
+		}
+		fmt.Println("✅ 商品全文索引已建立")
+	}
+}
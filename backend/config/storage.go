@@ -0,0 +1,117 @@
+package config
+
+import (
+	"crypto/rand"
+	"fmt"
+	"gotest/pkg/storage"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage 公开上传文件存储 (商品图片、头像)，InitStorage 之后可用
+var Storage storage.Storage
+
+// PrivateStorage 私有附件存储 (聊天图片、纠纷凭证)，只能通过签名链接访问
+var PrivateStorage storage.Storage
+
+// URLSigner 私有附件签名链接
+var URLSigner *storage.Signer
+
+// 私有附件的固定引用路径前缀，数据库中保存 /private/<key>，下发给前端时再签名
+const PrivatePrefix = "/private/"
+
+// InitStorage 按环境变量选择存储驱动
+// STORAGE_DRIVER=local (默认) 时保存到 <工作目录>/uploads，可用 STORAGE_LOCAL_DIR 覆盖
+// UPLOAD_PUBLIC_BASE_URL 为本地文件的公开访问地址 (如 https://cdn.example.com)，为空时使用相对路径 /uploads/
+// STORAGE_DRIVER=s3 时使用 S3_ENDPOINT / S3_REGION / S3_BUCKET / S3_ACCESS_KEY / S3_SECRET_KEY / S3_PUBLIC_URL
+// 私有附件保存到 <工作目录>/uploads_private (STORAGE_PRIVATE_LOCAL_DIR) 或 S3_PRIVATE_BUCKET，
+// 签名密钥 UPLOAD_SIGNING_SECRET (生产环境必填)，链接有效期 UPLOAD_SIGNED_URL_TTL_MINUTES (默认 60 分钟)
+func InitStorage() {
+	workDir, _ := os.Getwd()
+	cfg := storage.Config{
+		Driver:      os.Getenv("STORAGE_DRIVER"),
+		LocalDir:    os.Getenv("STORAGE_LOCAL_DIR"),
+		LocalPrefix: strings.TrimRight(os.Getenv("UPLOAD_PUBLIC_BASE_URL"), "/") + "/uploads/",
+		S3Endpoint:  os.Getenv("S3_ENDPOINT"),
+		S3Region:    os.Getenv("S3_REGION"),
+		S3Bucket:    os.Getenv("S3_BUCKET"),
+		S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+		S3PublicURL: os.Getenv("S3_PUBLIC_URL"),
+	}
+	if cfg.LocalDir == "" {
+		cfg.LocalDir = filepath.Join(workDir, "uploads")
+	}
+
+	privateCfg := cfg
+	privateCfg.LocalDir = os.Getenv("STORAGE_PRIVATE_LOCAL_DIR")
+	privateCfg.LocalPrefix = PrivatePrefix
+	privateCfg.S3Bucket = os.Getenv("S3_PRIVATE_BUCKET")
+	privateCfg.S3PublicURL = ""
+	if privateCfg.LocalDir == "" {
+		privateCfg.LocalDir = filepath.Join(workDir, "uploads_private")
+	}
+
+	var err error
+	Storage, err = storage.New(cfg)
+	if err != nil {
+		log.Fatal("❌ 文件存储初始化失败: ", err)
+	}
+	PrivateStorage, err = storage.New(privateCfg)
+	if err != nil {
+		log.Fatal("❌ 私有文件存储初始化失败: ", err)
+	}
+
+	secret := []byte(os.Getenv("UPLOAD_SIGNING_SECRET"))
+	if len(secret) == 0 {
+		// 不能用写死的默认密钥：知道源码就能伪造任意私有附件的链接
+		// 生产环境 (GIN_MODE=release) 必须配置；开发环境每次启动随机生成，重启后旧链接失效
+		if os.Getenv("GIN_MODE") == "release" {
+			log.Fatal("❌ 未配置 UPLOAD_SIGNING_SECRET，无法签发私有附件链接")
+		}
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal("❌ 生成签名密钥失败: ", err)
+		}
+		log.Println("⚠️ 未配置 UPLOAD_SIGNING_SECRET，已使用随机密钥，重启后已签发的私有附件链接将失效")
+	}
+	ttl := time.Hour
+	if m, err := strconv.Atoi(os.Getenv("UPLOAD_SIGNED_URL_TTL_MINUTES")); err == nil && m > 0 {
+		ttl = time.Duration(m) * time.Minute
+	}
+	URLSigner = &storage.Signer{Secret: secret, TTL: ttl}
+
+	if cfg.Driver == "s3" {
+		fmt.Println("✅ 文件存储: S3", cfg.S3Endpoint, cfg.S3Bucket, "私有:", privateCfg.S3Bucket)
+	} else {
+		fmt.Println("✅ 文件存储: 本地", cfg.LocalDir, "私有:", privateCfg.LocalDir)
+	}
+}
+
+// StorageFor 按是否私有选择存储
+func StorageFor(private bool) storage.Storage {
+	if private {
+		return PrivateStorage
+	}
+	return Storage
+}
+
+// UploadRef 文件保存到数据库的引用地址：公开文件为访问地址，私有文件为 /private/<key>
+func UploadRef(key string, private bool) string {
+	if private {
+		return PrivatePrefix + key
+	}
+	return Storage.URL(key)
+}
+
+// SignedURL 私有附件引用 (/private/<key>) 转为带签名的临时链接，其他地址原样返回
+func SignedURL(ref string) string {
+	if !strings.HasPrefix(ref, PrivatePrefix) || strings.Contains(ref, "?") {
+		return ref
+	}
+	return URLSigner.Sign(ref)
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadSettings 上传相关配置，可通过环境变量覆盖
+type UploadSettings struct {
+	MaxImageSize   int64 // 单张图片大小上限 (字节)，UPLOAD_MAX_IMAGE_MB，默认 10MB
+	MaxImageSide   int   // 宽、高上限 (像素)，UPLOAD_MAX_IMAGE_SIDE，默认 8192
+	MaxImagePixels int   // 像素总数上限，UPLOAD_MAX_IMAGE_MEGAPIXELS，默认 40 (百万像素)
+	MaxGIFPixels   int   // GIF 帧数 × 画布面积上限，固定 1 亿 (解码后约 100MB)
+	ThumbSizes     []int // 缩略图长边尺寸 (像素)，UPLOAD_THUMB_SIZES，默认 "200,800"
+
+	UserQuota       int64         // 每个用户的存储配额 (字节)，UPLOAD_USER_QUOTA_MB，默认 200MB
+	OrphanGrace     time.Duration // 未被引用的文件保留多久后删除，UPLOAD_ORPHAN_GRACE_HOURS，默认 24 小时
+	CleanupInterval time.Duration // 孤儿文件清理任务的执行间隔，固定 1 小时
+}
+
+var Upload = loadUploadSettings()
+
+func loadUploadSettings() UploadSettings {
+	s := UploadSettings{
+		MaxImageSize:   10 << 20,
+		MaxImageSide:   8192,
+		MaxImagePixels: 40_000_000,
+		MaxGIFPixels:   100_000_000,
+		ThumbSizes:     []int{200, 800},
+
+		UserQuota:       200 << 20,
+		OrphanGrace:     24 * time.Hour,
+		CleanupInterval: time.Hour,
+	}
+
+	if mb, err := strconv.Atoi(os.Getenv("UPLOAD_MAX_IMAGE_MB")); err == nil && mb > 0 {
+		s.MaxImageSize = int64(mb) << 20
+	}
+	if n, err := strconv.Atoi(os.Getenv("UPLOAD_MAX_IMAGE_SIDE")); err == nil && n > 0 {
+		s.MaxImageSide = n
+	}
+	if mp, err := strconv.Atoi(os.Getenv("UPLOAD_MAX_IMAGE_MEGAPIXELS")); err == nil && mp > 0 {
+		s.MaxImagePixels = mp * 1_000_000
+	}
+
+	if mb, err := strconv.Atoi(os.Getenv("UPLOAD_USER_QUOTA_MB")); err == nil && mb > 0 {
+		s.UserQuota = int64(mb) << 20
+	}
+	if h, err := strconv.Atoi(os.Getenv("UPLOAD_ORPHAN_GRACE_HOURS")); err == nil && h > 0 {
+		s.OrphanGrace = time.Duration(h) * time.Hour
+	}
+
+	if v := os.Getenv("UPLOAD_THUMB_SIZES"); v != "" {
+		var sizes []int
+		for _, part := range strings.Split(v, ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && n > 0 {
+				sizes = append(sizes, n)
+			}
+		}
+		if len(sizes) > 0 {
+			s.ThumbSizes = sizes
+		}
+	}
+	return s
+}
@@ -10,8 +10,8 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/gorilla/websocket v1.5.3
 	golang.org/x/crypto v0.45.0
+	golang.org/x/image v0.32.0
 	gorm.io/gorm v1.31.1
-
 )
 
 require (
@@ -4,7 +4,10 @@ import (
 	"gotest/config"
 	"gotest/internal/middleware"
 	"gotest/internal/models"
+	"gotest/internal/services"
+	"gotest/internal/utils"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -12,6 +15,9 @@ import (
 
 type AdminController struct{}
 
+// 列表查询复用 AdminService 的分页逻辑
+var adminService = new(services.AdminService)
+
 // Login 管理员登录
 func (a *AdminController) Login(c *gin.Context) {
 	var input struct {
@@ -118,11 +124,19 @@ func (a *AdminController) GetStats(c *gin.Context) {
 	})
 }
 
-// GetUsers 获取用户列表
+// GetUsers 获取用户列表 (游标分页，keyword 搜索用户名/昵称)
 func (a *AdminController) GetUsers(c *gin.Context) {
-	var users []models.User
-	config.DB.Find(&users)
-	c.JSON(http.StatusOK, gin.H{"data": users})
+	cursor, err := utils.ParseCursorPage(c, 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	users, total, next, err := adminService.GetUserList(cursor, c.Query("keyword"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": users, "total": total, "next_cursor": next})
 }
 
 // UpdateUserStatus 封禁/解封用户
@@ -139,11 +153,19 @@ func (a *AdminController) UpdateUserStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "操作成功"})
 }
 
-// GetProducts 获取商品列表
+// GetProducts 获取商品列表 (游标分页，keyword 搜索名称/描述)
 func (a *AdminController) GetProducts(c *gin.Context) {
-	var products []models.Product
-	config.DB.Preload("User").Order("created_at desc").Find(&products)
-	c.JSON(http.StatusOK, gin.H{"data": products})
+	cursor, err := utils.ParseCursorPage(c, 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	products, total, next, err := adminService.GetAdminProductList(cursor, c.Query("keyword"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取商品失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": products, "total": total, "next_cursor": next})
 }
 
 // AuditProduct 审核/下架商品
@@ -160,9 +182,170 @@ func (a *AdminController) AuditProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "操作成功"})
 }
 
-// GetOrders 获取订单列表
+// GetOrders 获取订单列表 (游标分页，keyword 搜索订单号)
 func (a *AdminController) GetOrders(c *gin.Context) {
-	var orders []models.Order
-	config.DB.Preload("Product").Preload("User").Order("created_at desc").Find(&orders)
-	c.JSON(http.StatusOK, gin.H{"data": orders})
+	cursor, err := utils.ParseCursorPage(c, 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	orders, total, next, err := adminService.GetAdminOrderList(cursor, c.Query("keyword"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": orders, "total": total, "next_cursor": next})
+}
+
+// GetCategories 获取全部分类树 (包含停用的)
+func (a *AdminController) GetCategories(c *gin.Context) {
+	categories, err := categoryService.Tree(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分类失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": categories})
+}
+
+// CreateCategory 新建分类
+func (a *AdminController) CreateCategory(c *gin.Context) {
+	var input services.CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	cat, err := categoryService.Create(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "创建成功", "data": cat})
+}
+
+// UpdateCategory 修改分类 (名称、父分类、图标、排序、启用状态)
+func (a *AdminController) UpdateCategory(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var input services.CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	cat, err := categoryService.Update(uint(id), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "data": cat})
+}
+
+// DeleteCategory 删除分类
+func (a *AdminController) DeleteCategory(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := categoryService.Delete(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// GetStorage 存储使用情况 (总量、去重后占用、未引用文件、按用户/类型统计)
+func (a *AdminController) GetStorage(c *gin.Context) {
+	usage, err := uploadService.Usage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取存储统计失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": usage})
+}
+
+// 内容过滤规则和审核队列
+var moderationAdmin = new(services.ModerationService)
+
+// GetModerationRules 全部内容过滤规则
+func (a *AdminController) GetModerationRules(c *gin.Context) {
+	rules, err := moderationAdmin.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// CreateModerationRule 新建规则 {"pattern", "is_regex", "action": "mask" | "block" | "flag", "enabled", "note"}
+func (a *AdminController) CreateModerationRule(c *gin.Context) {
+	var input services.ModerationRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	rule, err := moderationAdmin.CreateRule(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "创建成功", "data": rule})
+}
+
+// UpdateModerationRule 修改规则
+func (a *AdminController) UpdateModerationRule(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var input services.ModerationRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	rule, err := moderationAdmin.UpdateRule(uint(id), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "data": rule})
+}
+
+// DeleteModerationRule 删除规则
+func (a *AdminController) DeleteModerationRule(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := moderationAdmin.DeleteRule(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// GetModerationFlags 审核队列 (游标分页，status 默认 pending，传 all 返回全部)
+func (a *AdminController) GetModerationFlags(c *gin.Context) {
+	cursor, err := utils.ParseCursorPage(c, 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status := c.DefaultQuery("status", models.FlagPending)
+	if status == "all" {
+		status = ""
+	}
+	flags, total, next, err := moderationAdmin.ListFlags(cursor, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审核队列失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": flags, "total": total, "next_cursor": next})
+}
+
+// ReviewModerationFlag 处理审核记录 {"status": "approved" | "rejected"}，违规时下架商品 / 屏蔽消息
+func (a *AdminController) ReviewModerationFlag(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	adminID, _ := c.Get("userID")
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	flag, err := moderationAdmin.ReviewFlag(uint(id), adminID.(uint), input.Status)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "操作成功", "data": flag})
 }
@@ -49,14 +49,19 @@ func (cc *CartController) Add(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "不能将自己的商品加入购物车"})
 		return
 	}
+	if privacyService.IsBlocked(product.UserID, uid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "卖家已将你拉黑，无法购买"})
+		return
+	}
 
 	// 2. 检查购物车是否已存在该商品
 	var cartItem models.Cart
 	err := config.DB.Where("user_id = ? AND product_id = ?", uid, input.ProductID).First(&cartItem).Error
 
 	if err == nil {
-		// ★★★ 如果已存在，则累加数量 ★★★
+		// ★★★ 如果已存在，则累加数量，并按当前价格重新记录 ★★★
 		cartItem.Count += input.Count
+		cartItem.AddedPrice = product.Price
 		config.DB.Save(&cartItem)
 		c.JSON(http.StatusOK, gin.H{"message": "购物车数量已更新", "data": cartItem})
 		return
@@ -64,9 +69,10 @@ func (cc *CartController) Add(c *gin.Context) {
 
 	// 3. 不存在，创建新记录
 	newCart := models.Cart{
-		UserID:    uid,
-		ProductID: input.ProductID,
-		Count:     input.Count, // 使用传入的数量
+		UserID:     uid,
+		ProductID:  input.ProductID,
+		Count:      input.Count, // 使用传入的数量
+		AddedPrice: product.Price,
 	}
 
 	if err := config.DB.Create(&newCart).Error; err != nil {
@@ -93,8 +99,9 @@ func (cc *CartController) List(c *gin.Context) {
 		return
 	}
 
-	// 处理图片路径
+	// 重新校验每个条目 (是否售出、下架、改价)，并处理图片路径
 	for i := range list {
+		list[i].Revalidate()
 		if list[i].Product.Image == "" {
 			list[i].Product.Image = "/uploads/default_product.png"
 		}
@@ -118,3 +125,31 @@ func (cc *CartController) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
+
+// RemoveInvalid 一键清理已售出或已下架的购物车条目
+func (cc *CartController) RemoveInvalid(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var list []models.Cart
+	if err := config.DB.Preload("Product").Where("user_id = ?", userID).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取购物车失败"})
+		return
+	}
+
+	var ids []uint
+	for i := range list {
+		list[i].Revalidate()
+		if list[i].IsInvalid() {
+			ids = append(ids, list[i].ID)
+		}
+	}
+
+	if len(ids) > 0 {
+		if err := config.DB.Where("id IN ? AND user_id = ?", ids, userID).Delete(&models.Cart{}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "清理失败"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "清理完成", "removed": len(ids)})
+}
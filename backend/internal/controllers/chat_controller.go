@@ -1,16 +1,20 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"gotest/config"
 	"gotest/internal/middleware"
 	"gotest/internal/models"
+	"gotest/internal/utils"
 	"gotest/pkg/ws"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
 type ChatController struct {
@@ -43,11 +47,22 @@ func (cc *ChatController) Connect(c *gin.Context) {
 		return
 	}
 
+	// 重连时前端带上最后收到的消息 ID，连接建立后补发错过的消息
+	lastID, _ := strconv.Atoi(c.Query("last_id"))
+
+	// 协议版本：?v=2 使用 Envelope 协议，默认兼容旧版前端
+	version := 1
+	if c.Query("v") == "2" {
+		version = ws.ProtocolVersion
+	}
+
 	client := &ws.Client{
-		Hub:    cc.Hub,
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
-		UserID: claims.UserID,
+		Hub:      cc.Hub,
+		Conn:     conn,
+		Send:     make(chan *ws.Frame, 256),
+		UserID:   claims.UserID,
+		Version:  version,
+		SyncFrom: uint(lastID),
 	}
 
 	client.Hub.Register <- client
@@ -57,66 +72,352 @@ func (cc *ChatController) Connect(c *gin.Context) {
 }
 
 // GetHistory 获取历史消息
+// 带 conversation_id 时只返回该会话 (如关于某个商品的聊天) 并附带会话详情，否则返回与 target_id 的全部消息
+// type=1/2 只返回文字/图片消息；direction=newer 时从游标往新的方向翻 (配合跳转到某条消息后向下加载)
 func (cc *ChatController) GetHistory(c *gin.Context) {
 	uid, _ := c.Get("userID")
 	userID := uid.(uint)
 
-	targetIDStr := c.Query("target_id")
-	targetID, _ := strconv.Atoi(targetIDStr)
+	// 游标分页：默认从最新消息往前翻，next_cursor 指向更早的消息
+	cursor, err := utils.ParseCursorPage(c, 50, 200)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	msgType, err := parseMessageType(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newer := c.Query("direction") == "newer"
+
+	db, conv, err := messageScope(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	var conversation gin.H
+	if conv != nil && !cursor.HasCursor() {
+		conversation = cc.conversationDetail(conv, userID)
+	}
+	if msgType > 0 {
+		db = db.Where("type = ?", msgType)
+	}
 
 	var messages []models.Message
+	if err := cursor.Apply(db, "", !newer, "id").Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+	messages, nextCursor := utils.CursorResult(cursor, messages, func(m models.Message) (*float64, uint) { return nil, m.ID })
+
+	// 页内仍按时间正序返回，方便前端直接渲染
+	if !newer {
+		reverseMessages(messages)
+	}
+	signMessages(messages)
+
+	resp := gin.H{"data": messages, "next_cursor": nextCursor}
+	if conversation != nil {
+		resp["conversation"] = conversation
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// messageScope 按 conversation_id (优先) 或 target_id 限定消息范围，排除自己删除过的消息
+// 撤回的消息以占位文字返回 (带 recalled_at)；带 conversation_id 时同时返回会话
+func messageScope(c *gin.Context, userID uint) (*gorm.DB, *models.Conversation, error) {
+	if conversationID, _ := strconv.Atoi(c.Query("conversation_id")); conversationID > 0 {
+		var conv models.Conversation
+		if err := config.DB.First(&conv, conversationID).Error; err != nil || !conv.Has(userID) {
+			return nil, nil, errors.New("会话不存在")
+		}
+		return ws.ExcludeDeleted(config.DB.Where("conversation_id = ?", conv.ID), userID), &conv, nil
+	}
 
-	err := config.DB.Where(
+	targetID, _ := strconv.Atoi(c.Query("target_id"))
+	db := config.DB.Where(
 		"(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
 		userID, targetID, targetID, userID,
-	).Order("created_at asc").Find(&messages).Error
+	)
+	return ws.ExcludeDeleted(db, userID), nil, nil
+}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
-		return
+// parseMessageType 解析 type 筛选参数 (1:文字 2:图片，不传为全部)
+func parseMessageType(c *gin.Context) (int, error) {
+	s := c.Query("type")
+	if s == "" {
+		return 0, nil
+	}
+	t, err := strconv.Atoi(s)
+	if err != nil || (t != 1 && t != 2) {
+		return 0, errors.New("type 参数错误")
+	}
+	return t, nil
+}
+
+func reverseMessages(messages []models.Message) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+}
+
+// signMessages 私有图片下发临时签名链接
+func signMessages(messages []models.Message) {
+	for i := range messages {
+		if messages[i].Type == 2 {
+			messages[i].Content = config.SignedURL(messages[i].Content)
+		}
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{"data": messages})
+// contactRow 联系人列表的一行：会话 + 对方用户 + 关联商品
+type contactRow struct {
+	models.Conversation
+	PeerID        uint
+	Username      string
+	Nickname      string
+	Avatar        string
+	Unread        int
+	ProductName   string
+	ProductImage  string
+	ProductPrice  float64
+	ProductStatus int
 }
 
-// GetContacts 获取最近联系人列表 (真实逻辑修复版)
+// GetContacts 获取最近联系人列表 (每个会话一行，按最后一条消息倒序)
+// 同一个人就不同商品的咨询分别列出，从会话表一次查出，不再扫描消息表
 func (cc *ChatController) GetContacts(c *gin.Context) {
 	uid, _ := c.Get("userID")
-	userID := uid.(uint) // 现在这里使用了 userID，不会报 unused error
+	userID := uid.(uint)
 
-	// 1. 查出所有与我相关的消息 (按时间倒序)
-	var messages []models.Message
-	config.DB.Where("sender_id = ? OR receiver_id = ?", userID, userID).
-		Order("created_at desc").
-		Find(&messages)
-
-	// 2. 逻辑去重
-	contactMap := make(map[uint]bool)
-	var contacts []map[string]interface{}
-
-	for _, msg := range messages {
-		targetID := msg.SenderID
-		if msg.SenderID == userID {
-			targetID = msg.ReceiverID
-		}
+	// 游标为会话最后一条消息的 ID
+	cursor, err := utils.ParseCursorPage(c, 50, 200)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		if contactMap[targetID] {
-			continue
+	db := config.DB.Table("conversations").
+		Select(`conversations.*, users.id AS peer_id, users.username, users.nickname, users.avatar,
+			CASE WHEN conversations.user_a_id = ? THEN conversations.unread_a ELSE conversations.unread_b END AS unread,
+			products.name AS product_name, products.image AS product_image,
+			products.price AS product_price, products.status AS product_status`, userID).
+		Joins("JOIN users ON users.id = CASE WHEN conversations.user_a_id = ? THEN conversations.user_b_id ELSE conversations.user_a_id END", userID).
+		Joins("LEFT JOIN products ON products.id = conversations.product_id").
+		Where("(conversations.user_a_id = ? OR conversations.user_b_id = ?) AND conversations.last_message_id > 0", userID, userID)
+
+	var rows []contactRow
+	if err := cursor.Apply(db, "", true, "conversations.last_message_id").Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取联系人失败"})
+		return
+	}
+	rows, nextCursor := utils.CursorResult(cursor, rows, func(r contactRow) (*float64, uint) { return nil, r.LastMessageID })
+
+	// 在线状态一次批量查询，不逐个联系人访问总线
+	peerIDs := make([]uint, len(rows))
+	for i, r := range rows {
+		peerIDs[i] = r.PeerID
+	}
+	online := cc.Hub.OnlineDevicesOf(peerIDs)
+
+	contacts := make([]gin.H, 0, len(rows))
+	for _, r := range rows {
+		lastMsg := r.LastMessage
+		if r.LastMessageType == 2 {
+			lastMsg = config.SignedURL(lastMsg)
+		}
+		contact := gin.H{
+			"id":              r.PeerID, // 对方用户 ID (兼容旧前端)
+			"conversation_id": r.Conversation.ID,
+			"username":        r.Username,
+			"nickname":        r.Nickname,
+			"avatar":          r.Avatar,
+			"last_msg":        lastMsg,
+			"last_msg_id":     r.LastMessageID,
+			"last_sender_id":  r.LastSenderID,
+			"online":          online[r.PeerID] > 0,
+			"unread":          r.Unread,
+			"time":            r.LastMessageAt,
+			"product":         nil,
+		}
+		if r.ProductID > 0 && r.ProductName != "" {
+			contact["product"] = gin.H{
+				"id":     r.ProductID,
+				"name":   r.ProductName,
+				"image":  r.ProductImage,
+				"price":  r.ProductPrice,
+				"status": r.ProductStatus,
+			}
 		}
-		contactMap[targetID] = true
+		contacts = append(contacts, contact)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": contacts, "next_cursor": nextCursor, "unread_total": ws.ConversationUnread(userID)})
+}
 
-		var user models.User
-		config.DB.First(&user, targetID)
+// productCard 会话关联的商品卡片 (商品已删除时返回 nil)
+func productCard(productID uint) gin.H {
+	if productID == 0 {
+		return nil
+	}
+	var product models.Product
+	if err := config.DB.First(&product, productID).Error; err != nil {
+		return nil
+	}
+	return gin.H{
+		"id":        product.ID,
+		"name":      product.Name,
+		"image":     product.Image,
+		"price":     product.Price,
+		"status":    product.Status,
+		"seller_id": product.UserID,
+	}
+}
 
-		contacts = append(contacts, map[string]interface{}{
-			"id":       user.ID,
-			"username": user.Username,
-			"nickname": user.Nickname,
-			"avatar":   user.Avatar,
-			"last_msg": msg.Content,
-			"time":     msg.CreatedAt,
-		})
+// conversationDetail 会话详情：会话本身、对方用户和商品卡片
+func (cc *ChatController) conversationDetail(conv *models.Conversation, userID uint) gin.H {
+	var peer models.User
+	config.DB.Select("id", "username", "nickname", "avatar").First(&peer, conv.PeerOf(userID))
+	return gin.H{
+		"id":         conv.ID,
+		"product_id": conv.ProductID,
+		"product":    productCard(conv.ProductID),
+		"peer": gin.H{
+			"id":       peer.ID,
+			"username": peer.Username,
+			"nickname": peer.Nickname,
+			"avatar":   peer.Avatar,
+			"online":   cc.Hub.IsOnline(peer.ID),
+		},
+		"last_message_id": conv.LastMessageID,
 	}
+}
+
+// OpenConversation 打开与某人的会话 (从商品详情页发起时带 product_id)，不存在时创建
+// 请求：{"target_id": 卖家 ID, "product_id": 商品 ID}
+func (cc *ChatController) OpenConversation(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	userID := uid.(uint)
 
-	c.JSON(http.StatusOK, gin.H{"data": contacts})
+	var input struct {
+		TargetID  uint `json:"target_id" binding:"required"`
+		ProductID uint `json:"product_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	if input.TargetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能和自己聊天"})
+		return
+	}
+	var target models.User
+	if err := config.DB.Select("id").First(&target, input.TargetID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if privacyService.IsBlocked(input.TargetID, userID) || privacyService.IsBlocked(userID, input.TargetID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "你们之间存在拉黑关系，无法发起聊天"})
+		return
+	}
+
+	conv, err := ws.ResolveConversation(config.DB, userID, input.TargetID, input.ProductID)
+	if errors.Is(err, ws.ErrProductNotInConversation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cc.conversationDetail(conv, userID)})
+}
+
+// MarkRead 将与某人的会话标记为已读 (带 conversation_id 时只标记该会话)，并向对方推送已读回执
+func (cc *ChatController) MarkRead(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	targetID, err := strconv.Atoi(c.Param("target_id"))
+	if err != nil || targetID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "会话参数错误"})
+		return
+	}
+
+	// 可选 conversation_id：只标记这一个会话
+	conversationID, _ := strconv.Atoi(c.Query("conversation_id"))
+
+	receipt, err := cc.Hub.MarkConversationRead(uid.(uint), uint(targetID), uint(conversationID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已读", "data": receipt})
+}
+
+// RecallMessage 撤回自己发送的消息 (发送后 config.Chat.RecallWindow 内)
+func (cc *ChatController) RecallMessage(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息参数错误"})
+		return
+	}
+
+	notice, err := cc.Hub.RecallMessage(uid.(uint), uint(id))
+	switch {
+	case errors.Is(err, ws.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ws.ErrNotSender):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ws.ErrRecallExpired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("只能撤回 %d 分钟内发送的消息", int(config.Chat.RecallWindow.Minutes()))})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤回失败"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "已撤回", "data": notice})
+	}
+}
+
+// DeleteMessage 从自己的聊天记录中删除消息，对方不受影响
+func (cc *ChatController) DeleteMessage(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息参数错误"})
+		return
+	}
+
+	notice, err := cc.Hub.DeleteMessageForUser(uid.(uint), uint(id))
+	switch {
+	case errors.Is(err, ws.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "已删除", "data": notice})
+	}
+}
+
+// Online 查询用户在线状态和在线设备数 (user_ids=1,2,3，最多 100 个)
+func (cc *ChatController) Online(c *gin.Context) {
+	var ids []uint
+	for _, part := range strings.Split(c.Query("user_ids"), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id <= 0 {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	if len(ids) == 0 || len(ids) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids 参数错误"})
+		return
+	}
+
+	devices := cc.Hub.OnlineDevicesOf(ids)
+	result := make(map[uint]gin.H, len(ids))
+	for _, id := range ids {
+		result[id] = gin.H{"online": devices[id] > 0, "devices": devices[id]}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
 }
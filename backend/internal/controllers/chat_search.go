@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"gotest/config"
+	"gotest/internal/models"
+	"gotest/internal/utils"
+	"gotest/pkg/ws"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SearchMessages 在自己的所有会话中搜索聊天记录 (游标分页，按时间倒序)
+// keyword 按空白拆分，须全部命中 (只搜文字消息，不含撤回的)；type=2 且不带 keyword 时列出所有图片
+// 可用 conversation_id / target_id 缩小到某个会话
+func (cc *ChatController) SearchMessages(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	userID := uid.(uint)
+
+	cursor, err := utils.ParseCursorPage(c, 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	msgType, err := parseMessageType(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	terms := splitSearchTerms(c.Query("keyword"))
+	if len(terms) == 0 && msgType == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入搜索关键词"})
+		return
+	}
+
+	db := ws.ExcludeDeleted(config.DB.Where("(sender_id = ? OR receiver_id = ?)", userID, userID), userID)
+	if c.Query("conversation_id") != "" || c.Query("target_id") != "" {
+		if db, _, err = messageScope(c, userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(terms) > 0 {
+		// 图片消息的内容是地址，关键词只匹配文字消息
+		db = db.Where("type = ? AND recalled_at IS NULL", 1)
+		// 关键词中的 % _ \ 按字面匹配，不作为通配符
+		for _, t := range terms {
+			db = db.Where(`content LIKE ? ESCAPE '\'`, utils.LikeContains(t))
+		}
+	}
+	if msgType > 0 {
+		db = db.Where("type = ?", msgType)
+	}
+
+	var messages []models.Message
+	if err := cursor.Apply(db, "", true, "id").Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索失败"})
+		return
+	}
+	messages, nextCursor := utils.CursorResult(cursor, messages, func(m models.Message) (*float64, uint) { return nil, m.ID })
+
+	// 一次查出结果中涉及的对方用户
+	peerIDs := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		peerIDs = append(peerIDs, peerOf(m, userID))
+	}
+	var peers []models.User
+	if len(peerIDs) > 0 {
+		config.DB.Select("id", "username", "nickname", "avatar").Where("id IN ?", peerIDs).Find(&peers)
+	}
+	peerByID := make(map[uint]models.User, len(peers))
+	for _, p := range peers {
+		peerByID[p.ID] = p
+	}
+
+	signMessages(messages)
+	results := make([]gin.H, 0, len(messages))
+	for _, m := range messages {
+		peer := peerByID[peerOf(m, userID)]
+		item := gin.H{
+			"message":         m,
+			"conversation_id": m.ConversationID,
+			"peer": gin.H{
+				"id":       peer.ID,
+				"username": peer.Username,
+				"nickname": peer.Nickname,
+				"avatar":   peer.Avatar,
+			},
+		}
+		if len(terms) > 0 {
+			item["snippet"] = utils.Snippet(m.Content, terms, 20)
+		}
+		results = append(results, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": results, "next_cursor": nextCursor})
+}
+
+func peerOf(m models.Message, userID uint) uint {
+	if m.SenderID == userID {
+		return m.ReceiverID
+	}
+	return m.SenderID
+}
+
+// mediaItem 图库中的一张图片
+type mediaItem struct {
+	MessageID uint      `json:"message_id"`
+	SenderID  uint      `json:"sender_id"`
+	URL       string    `json:"url"`
+	Thumbnail string    `json:"thumbnail"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetMedia 会话图库：某个会话 (conversation_id) 或与某人 (target_id) 的所有图片，游标分页，新的在前
+// 返回签名后的原图和最小缩略图地址，以及图片尺寸 (方便前端排版)
+func (cc *ChatController) GetMedia(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	userID := uid.(uint)
+
+	cursor, err := utils.ParseCursorPage(c, 30, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("conversation_id") == "" && c.Query("target_id") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 conversation_id 或 target_id"})
+		return
+	}
+	db, _, err := messageScope(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var messages []models.Message
+	if err := cursor.Apply(db.Where("type = ?", 2), "", true, "id").Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片失败"})
+		return
+	}
+	messages, nextCursor := utils.CursorResult(cursor, messages, func(m models.Message) (*float64, uint) { return nil, m.ID })
+
+	// 按引用地址找上传记录，取尺寸和缩略图
+	refs := make([]string, 0, len(messages))
+	for _, m := range messages {
+		refs = append(refs, m.Content)
+	}
+	var uploads []models.Upload
+	if len(refs) > 0 {
+		config.DB.Where("url IN ?", refs).Find(&uploads)
+	}
+	uploadByURL := make(map[string]models.Upload, len(uploads))
+	for _, u := range uploads {
+		uploadByURL[u.URL] = u
+	}
+
+	items := make([]mediaItem, 0, len(messages))
+	for _, m := range messages {
+		item := mediaItem{
+			MessageID: m.ID,
+			SenderID:  m.SenderID,
+			URL:       config.SignedURL(m.Content),
+			CreatedAt: m.CreatedAt,
+		}
+		item.Thumbnail = item.URL
+		if u, ok := uploadByURL[m.Content]; ok {
+			item.Width, item.Height = u.Width, u.Height
+			if thumbs := u.Thumbs(); len(thumbs) > 0 {
+				item.Thumbnail = config.SignedURL(config.UploadRef(thumbs[0].Key, u.Private))
+			}
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": items, "next_cursor": nextCursor})
+}
+
+// MessageContext 跳转到某条消息 (如搜索结果)：返回它前后各 limit 条 (默认 20)，按时间正序
+// older_cursor / newer_cursor 交给 GetHistory (后者加 direction=newer) 继续向上 / 向下加载，为空表示已到头
+func (cc *ChatController) MessageContext(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	userID := uid.(uint)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	page, err := utils.ParseCursorPage(c, 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var target models.Message
+	if err := ws.ExcludeDeleted(config.DB, userID).First(&target, id).Error; err != nil ||
+		(target.SenderID != userID && target.ReceiverID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	// 与 GetHistory 相同的范围：有会话时按会话，否则按两人之间
+	scope := func() *gorm.DB {
+		if target.ConversationID > 0 {
+			return ws.ExcludeDeleted(config.DB.Where("conversation_id = ?", target.ConversationID), userID)
+		}
+		peer := peerOf(target, userID)
+		return ws.ExcludeDeleted(config.DB.Where(
+			"(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
+			userID, peer, peer, userID,
+		), userID)
+	}
+
+	before, after := &utils.CursorPage{Limit: page.Limit}, &utils.CursorPage{Limit: page.Limit}
+	var older, newer []models.Message
+	if err := before.Apply(scope().Where("id < ?", target.ID), "", true, "id").Find(&older).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+	if err := after.Apply(scope().Where("id > ?", target.ID), "", false, "id").Find(&newer).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+	older, olderCursor := utils.CursorResult(before, older, func(m models.Message) (*float64, uint) { return nil, m.ID })
+	newer, newerCursor := utils.CursorResult(after, newer, func(m models.Message) (*float64, uint) { return nil, m.ID })
+
+	reverseMessages(older)
+	messages := append(append(older, target), newer...)
+	signMessages(messages)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":            messages,
+		"target_id":       target.ID,
+		"conversation_id": target.ConversationID,
+		"older_cursor":    olderCursor,
+		"newer_cursor":    newerCursor,
+	})
+}
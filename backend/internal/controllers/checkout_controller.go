@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"gotest/config"
+	"gotest/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CheckoutController struct {
+	// 直接使用 config.DB
+}
+
+// Detail 获取结算单详情 (子订单按卖家分组)
+func (cc *CheckoutController) Detail(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var checkout models.Checkout
+	if err := config.DB.Where("id = ? AND user_id = ?", id, userID).First(&checkout).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "结算单不存在"})
+		return
+	}
+
+	if err := config.DB.Preload("Product").Preload("Seller").Preload("Items").
+		Where("checkout_id = ?", checkout.ID).Order("seller_id asc, id asc").
+		Find(&checkout.Orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取子订单失败"})
+		return
+	}
+	for i := range checkout.Orders {
+		checkout.Orders[i].ApplySnapshot()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": checkout, "groups": groupOrdersBySeller(checkout.Orders)})
+}
+
+// Pay 结算单统一支付：一次支付，按子订单价格分摊到每个待支付的子订单
+func (cc *CheckoutController) Pay(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	tx := config.DB.Begin()
+
+	var checkout models.Checkout
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&checkout).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "结算单不存在"})
+		return
+	}
+	if checkout.Status != 1 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结算单状态不正确，可能已支付或已取消"})
+		return
+	}
+
+	// 下单后被其中某个卖家拉黑的，要先取消该卖家的子订单
+	var blocked int64
+	tx.Model(&models.Order{}).
+		Where("checkout_id = ? AND status = ?", checkout.ID, 1).
+		Where("seller_id IN (SELECT blocker_id FROM user_blocks WHERE blocked_id = ?)", checkout.UserID).
+		Count(&blocked)
+	if blocked > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "有卖家已将你拉黑，请先取消该卖家的订单再支付"})
+		return
+	}
+
+	// 1. 待支付的子订单全部转为待发货，实付金额等于成交价
+	if err := tx.Model(&models.Order{}).
+		Where("checkout_id = ? AND status = ?", checkout.ID, 1).
+		Updates(map[string]interface{}{"status": 2, "paid_amount": gorm.Expr("price")}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "支付失败"})
+		return
+	}
+
+	// 2. 重新汇总结算单
+	now := time.Now()
+	if err := tx.Model(&checkout).Update("paid_at", &now).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "支付失败"})
+		return
+	}
+	if err := refreshCheckout(tx, checkout.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "支付失败"})
+		return
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"message": "支付成功"})
+}
+
+// refreshCheckout 根据子订单状态重新计算结算单的金额和状态
+// 全部取消 -> 已取消；没有待支付子订单 -> 已支付；否则保持待支付
+func refreshCheckout(tx *gorm.DB, checkoutID uint) error {
+	if checkoutID == 0 {
+		return nil
+	}
+
+	var orders []models.Order
+	if err := tx.Where("checkout_id = ?", checkoutID).Find(&orders).Error; err != nil {
+		return err
+	}
+
+	var total, paid, refund float64
+	pending, cancelled := 0, 0
+	for _, order := range orders {
+		switch order.Status {
+		case 1:
+			pending++
+			total += order.Price
+		case 5:
+			cancelled++
+			refund += order.PaidAmount
+		default:
+			total += order.Price
+			paid += order.PaidAmount
+		}
+	}
+
+	status := 1
+	if cancelled == len(orders) {
+		status = 5
+	} else if pending == 0 {
+		status = 2
+	}
+
+	return tx.Model(&models.Checkout{}).Where("id = ?", checkoutID).Updates(map[string]interface{}{
+		"total_amount":  total,
+		"paid_amount":   paid,
+		"refund_amount": refund,
+		"status":        status,
+	}).Error
+}
+
+// groupOrdersBySeller 将子订单按卖家分组，保持出现顺序
+func groupOrdersBySeller(orders []models.Order) []gin.H {
+	var groups []gin.H
+	index := make(map[uint]int)
+	for _, order := range orders {
+		i, ok := index[order.SellerID]
+		if !ok {
+			i = len(groups)
+			index[order.SellerID] = i
+			groups = append(groups, gin.H{
+				"seller_id": order.SellerID,
+				"seller":    order.Seller,
+				"orders":    []models.Order{},
+				"subtotal":  0.0,
+			})
+		}
+		groups[i]["orders"] = append(groups[i]["orders"].([]models.Order), order)
+		if order.Status != 5 {
+			groups[i]["subtotal"] = groups[i]["subtotal"].(float64) + order.Price
+		}
+	}
+	return groups
+}
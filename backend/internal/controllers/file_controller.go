@@ -1,10 +1,21 @@
 package controllers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"gotest/config"
+	"gotest/internal/models"
+	"gotest/internal/services"
+	"gotest/internal/utils"
+	"gotest/pkg/storage"
+	"io"
+	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,7 +23,23 @@ import (
 
 type FileController struct{}
 
-// Upload 处理文件上传
+// 上传记录、去重与配额
+var uploadService = new(services.UploadService)
+
+// 图片格式对应的保存扩展名
+var imageExt = map[string]string{
+	utils.ImageJPEG: ".jpg",
+	utils.ImagePNG:  ".png",
+	utils.ImageGIF:  ".gif",
+	utils.ImageWebP: ".webp",
+}
+
+// 上传用途：聊天图片和纠纷凭证保存到私有存储，其余 (商品图片、头像) 为公开文件
+var privatePurposes = map[string]bool{models.UploadPurposeChat: true, models.UploadPurposeEvidence: true}
+
+// Upload 处理图片上传
+// 按文件内容识别真实格式 (JPEG/PNG/WebP/GIF)，去掉 EXIF/GPS 等元数据后保存，并生成缩略图
+// 表单参数 purpose: product (默认) / avatar / chat / evidence
 func (fc *FileController) Upload(c *gin.Context) {
 	// 1. 防崩溃保护
 	defer func() {
@@ -28,41 +55,233 @@ func (fc *FileController) Upload(c *gin.Context) {
 		return
 	}
 
-	// 2. ★★★ 动态获取当前运行目录 ★★★
-	// 无论你在 C盘、D盘 还是 E盘，它都能找到当前程序所在的位置
-	workDir, _ := os.Getwd()
-	uploadDir := filepath.Join(workDir, "uploads")
+	purpose := c.DefaultPostForm("purpose", models.UploadPurposeProduct)
+	if purpose != models.UploadPurposeProduct && purpose != models.UploadPurposeAvatar && !privatePurposes[purpose] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "purpose 参数错误"})
+		return
+	}
+	private := privatePurposes[purpose]
+	store := config.StorageFor(private)
 
-	// 3. 自动创建文件夹
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.MkdirAll(uploadDir, 0755)
+	// 2. 大小限制 (多读 1 字节判断是否超限，不信任客户端声明的大小)
+	maxSize := config.Upload.MaxImageSize
+	tooLarge := gin.H{"error": fmt.Sprintf("图片不能超过 %dMB", maxSize>>20)}
+	if file.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(src, maxSize+1))
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	if int64(len(data)) > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
 	}
 
-	// 4. 生成文件名
-	ext := filepath.Ext(file.Filename)
-	// 使用纳秒时间戳，确保唯一性
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	dst := filepath.Join(uploadDir, filename)
+	userID, _ := c.Get("userID")
+	uid := userID.(uint)
+	sum := sha256.Sum256(data)
+	upload := models.Upload{UserID: uid, Hash: hex.EncodeToString(sum[:]), Private: private, Purpose: purpose}
 
-	// 5. 保存文件
-	if err := c.SaveUploadedFile(file, dst); err != nil {
-		fmt.Println("文件保存失败:", err)
+	// 3. 同一用户重复上传相同内容，直接返回已有记录
+	if existing, err := uploadService.FindOwn(uid, upload.Hash, private, purpose); err == nil {
+		c.JSON(http.StatusOK, uploadResponse(existing))
+		return
+	}
+
+	// 4. 其他用户上传过相同内容时复用存储中的文件，否则识别格式并清理元数据
+	var img *utils.ProcessedImage
+	if shared, err := uploadService.FindShared(upload.Hash, private); err == nil {
+		upload.StorageKey, upload.ThumbKeys = shared.StorageKey, shared.ThumbKeys
+		upload.Size, upload.MimeType = shared.Size, shared.MimeType
+		upload.Width, upload.Height = shared.Width, shared.Height
+	} else {
+		img, err = utils.ProcessImage(data, utils.ImageLimits{
+			MaxSide:      config.Upload.MaxImageSide,
+			MaxPixels:    config.Upload.MaxImagePixels,
+			MaxGIFPixels: config.Upload.MaxGIFPixels,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		upload.Size, upload.MimeType = int64(len(img.Data)), utils.MimeType(img.Format)
+		upload.Width, upload.Height = img.Width, img.Height
+	}
+
+	// 5. 配额检查
+	if used := uploadService.UsedBytes(uid); used+upload.Size > config.Upload.UserQuota {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("存储空间不足 (已用 %.1fMB / %dMB)，请删除不用的商品或图片", float64(used)/(1<<20), config.Upload.UserQuota>>20)})
+		return
+	}
+
+	if img != nil {
+		// 6. 生成文件名 (扩展名按真实格式)
+		// 使用纳秒时间戳，确保唯一性
+		base := fmt.Sprintf("%d", time.Now().UnixNano())
+		upload.StorageKey = base + imageExt[img.Format]
+
+		// 7. 保存到存储后端 (本地磁盘或 S3，私有附件保存到私有存储)
+		if err := store.Put(upload.StorageKey, img.Data, upload.MimeType); err != nil {
+			fmt.Println("文件保存失败:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+
+		// 8. 生成缩略图 (动画 WebP 无法解码，不生成缩略图，前端直接使用原图)
+		var thumbs []models.Thumb
+		if img.Image != nil {
+			for _, size := range config.Upload.ThumbSizes {
+				// 原图已经不大于该尺寸时直接用原图
+				if img.Width <= size && img.Height <= size {
+					thumbs = append(thumbs, models.Thumb{Size: size, Key: upload.StorageKey})
+					continue
+				}
+				thumb, ext, err := utils.EncodeThumbnail(img.Image, img.Format, size)
+				if err != nil {
+					fmt.Println("缩略图生成失败:", err)
+					continue
+				}
+				name := fmt.Sprintf("%s_%d%s", base, size, ext)
+				if err := store.Put(name, thumb, mime.TypeByExtension(ext)); err != nil {
+					fmt.Println("缩略图保存失败:", err)
+					continue
+				}
+				thumbs = append(thumbs, models.Thumb{Size: size, Key: name})
+			}
+		}
+		upload.SetThumbs(thumbs)
+	}
+
+	// 9. 记录上传，发布商品时通过 ID 引用
+	// 保存的是与访问域名无关的地址 (本地存储为 /uploads/xxx 或配置的公开地址，私有附件为 /private/xxx)
+	upload.URL = config.UploadRef(upload.StorageKey, upload.Private)
+	if err := config.DB.Create(&upload).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
 		return
 	}
 
-	fmt.Println(">>> 图片已保存至:", dst)
+	c.JSON(http.StatusOK, uploadResponse(&upload))
+}
 
-	// 6. ★★★ 动态生成访问 URL ★★★
-	// c.Request.Host 会自动获取当前访问的 IP:端口 (如 localhost:8081 或 192.168.1.5:8081)
-	// 这样换了电脑、换了 IP 也能正常显示
-	protocol := "http://"
-	if c.Request.TLS != nil {
-		protocol = "https://"
+// uploadResponse 上传接口的返回内容
+// 私有附件的 url 是保存用的引用地址 (/private/xxx)，发消息时使用它；signed_url 为当前可访问的临时链接
+func uploadResponse(u *models.Upload) gin.H {
+	thumbnails := []gin.H{}
+	for _, t := range u.Thumbs() {
+		thumbnails = append(thumbnails, gin.H{"size": t.Size, "url": config.SignedURL(config.UploadRef(t.Key, u.Private))})
+	}
+	ref := config.UploadRef(u.StorageKey, u.Private)
+	resp := gin.H{
+		"id":         u.ID,
+		"key":        u.StorageKey,
+		"url":        ref,
+		"width":      u.Width,
+		"height":     u.Height,
+		"size":       u.Size,
+		"mime_type":  u.MimeType,
+		"private":    u.Private,
+		"thumbnails": thumbnails,
+	}
+	if u.Private {
+		resp["signed_url"] = config.SignedURL(ref)
 	}
-	fullURL := fmt.Sprintf("%s%s/uploads/%s", protocol, c.Request.Host, filename)
+	return resp
+}
+
+// 没有图片的商品统一显示的占位图 (/uploads/default_product.png)
+// 随程序打包，不依赖存储后端：使用 S3 存储时桶里没有这个文件
+const defaultProductImageKey = "default_product.png"
+
+//go:embed assets/default_product.png
+var defaultProductImage []byte
+
+// Serve 通过存储后端读取 /uploads/ 下的公开文件 (不提供目录列表)
+func (fc *FileController) Serve(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if key == defaultProductImageKey {
+		c.Header("Cache-Control", "public, max-age=86400")
+		http.ServeContent(c.Writer, c.Request, key, time.Time{}, bytes.NewReader(defaultProductImage))
+		return
+	}
+	serveObject(c, config.Storage, key, "public, max-age=86400")
+}
+
+// ServePrivate 读取 /private/ 下的私有附件，必须带有效的签名和过期时间
+func (fc *FileController) ServePrivate(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	remaining, err := config.URLSigner.Verify(config.PrivatePrefix+key, c.Query("expires"), c.Query("sig"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	serveObject(c, config.PrivateStorage, key, fmt.Sprintf("private, max-age=%d", int(remaining.Seconds())))
+}
+
+// SignURL 为私有附件签发临时链接 (url=/private/xxx)
+// 仅上传者本人、或上传者发出的聊天消息的收发双方可以获取
+func (fc *FileController) SignURL(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uid := userID.(uint)
+
+	ref := c.Query("url")
+	if i := strings.Index(ref, "?"); i >= 0 {
+		ref = ref[:i]
+	}
+	if !strings.HasPrefix(ref, config.PrivatePrefix) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能为私有附件签发链接"})
+		return
+	}
+
+	var owned, inChat int64
+	config.DB.Model(&models.Upload{}).Where("private = ? AND url = ? AND user_id = ?", true, ref, uid).Count(&owned)
+	if owned == 0 {
+		// 消息中的附件须为发送者本人上传的 (没有上传记录的是迁移过来的旧聊天图片)，
+		// 防止把别人的附件发给自己来获取链接
+		config.DB.Model(&models.Message{}).
+			Where("type = ? AND content = ? AND (sender_id = ? OR receiver_id = ?)", 2, ref, uid, uid).
+			Where("(EXISTS (SELECT 1 FROM uploads WHERE uploads.private = ? AND uploads.url = messages.content AND uploads.user_id = messages.sender_id)"+
+				" OR NOT EXISTS (SELECT 1 FROM uploads WHERE uploads.private = ? AND uploads.url = messages.content))", true, true).
+			Count(&inChat)
+	}
+	if owned == 0 && inChat == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看此附件"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": config.SignedURL(ref), "expires_in": int(config.URLSigner.TTL.Seconds())})
+}
+
+// serveObject 从指定存储读取文件并输出
+func serveObject(c *gin.Context, store storage.Storage, key, cacheControl string) {
+	rc, info, err := store.Get(key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("读取文件失败:", err)
+		c.Status(http.StatusBadGateway)
+		return
+	}
+	defer rc.Close()
 
-	c.JSON(http.StatusOK, gin.H{
-		"url": fullURL,
-	})
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+	c.Header("Cache-Control", cacheControl)
+	// 本地文件支持 Range / If-Modified-Since
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, key, info.ModTime, rs)
+		return
+	}
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, rc, nil)
 }
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"gotest/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationController struct {
+	Service *services.NotificationService
+}
+
+// List 获取我的通知
+func (nc *NotificationController) List(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	list, unread, err := nc.Service.List(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通知失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list, "unread": unread})
+}
+
+// MarkRead 标记通知已读 (id 为 all 时全部已读)
+func (nc *NotificationController) MarkRead(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var id uint
+	if idStr := c.Param("id"); idStr != "all" {
+		n, err := strconv.Atoi(idStr)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+			return
+		}
+		id = uint(n)
+	}
+
+	if err := nc.Service.MarkRead(userID.(uint), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已读"})
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"fmt"
 	"gotest/config"
 	"gotest/internal/models"
+	"gotest/internal/services"
+	"gotest/internal/utils"
 	"net/http"
 	"strconv" // ★★★ 新增：用于订单号拼接
 	"time"
@@ -11,7 +14,8 @@ import (
 )
 
 type OrderController struct {
-	// 直接使用 config.DB
+	// 数据操作直接使用 config.DB，通知服务用于提醒收藏者商品即将售出
+	Notifier *services.NotificationService
 }
 
 // Create 创建订单 (单商品直接购买)
@@ -32,8 +36,8 @@ func (o *OrderController) Create(c *gin.Context) {
 
 	// 2. 查询商品
 	var product models.Product
-	// 加锁查询防止超卖
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&product, input.ProductID).Error; err != nil {
+	// 加锁查询防止超卖 (预加载卖家，用于生成快照)
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Preload("User").First(&product, input.ProductID).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
 		return
@@ -50,6 +54,11 @@ func (o *OrderController) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "不能购买自己的商品"})
 		return
 	}
+	if privacyService.IsBlocked(product.UserID, uid) {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "卖家已将你拉黑，无法购买"})
+		return
+	}
 
 	// 4. 创建订单
 	order := models.Order{
@@ -59,6 +68,8 @@ func (o *OrderController) Create(c *gin.Context) {
 		ProductID: product.ID,
 		Price:     product.Price,
 		Status:    1, // 1: 待支付
+		Snapshot:  models.NewOrderSnapshot(product),
+		Items:     []models.OrderItem{models.NewOrderItem(product)},
 	}
 
 	if err := tx.Create(&order).Error; err != nil {
@@ -75,12 +86,17 @@ func (o *OrderController) Create(c *gin.Context) {
 	}
 
 	tx.Commit()
+
+	// 6. 通知其他收藏者：商品即将售出
+	if o.Notifier != nil {
+		o.Notifier.NotifyAlmostSold(product, uid)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "下单成功", "data": order})
 }
 
 func (o *OrderController) List(c *gin.Context) {
 	userID, _ := c.Get("userID")
-	role := c.Query("role")
 
 	var orders []models.Order
 
@@ -88,28 +104,37 @@ func (o *OrderController) List(c *gin.Context) {
 	// 1. Product: 获取商品名、图片
 	// 2. Seller: 获取卖家头像、昵称
 	// 3. User: 获取买家信息
-	db := config.DB.Preload("Product").Preload("User").Preload("Seller")
+	// 4. Items: 同一卖家多件商品合并的订单明细
+	db := config.DB.Preload("Product").Preload("User").Preload("Seller").Preload("Items")
 
-	if role == "seller" {
-		db = db.Where("seller_id = ?", userID)
-	} else {
-		db = db.Where("user_id = ?", userID)
+	// 按角色 / 日期 / 状态过滤 (与导出接口共用)
+	db, err := applyOrderFilters(db, c, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// 按时间倒序
-	if err := db.Order("created_at desc").Find(&orders).Error; err != nil {
+	// 游标分页，按下单先后倒序
+	cursor, err := utils.ParseCursorPage(c, 20, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := cursor.Apply(db, "", true, "orders.id").Find(&orders).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单失败"})
 		return
 	}
+	orders, nextCursor := utils.CursorResult(cursor, orders, func(o models.Order) (*float64, uint) { return nil, o.ID })
 
-	// 图片路径处理 (防止前端裂图)
+	// 用下单快照覆盖商品信息，再做图片路径处理 (防止前端裂图)
 	for i := range orders {
+		orders[i].ApplySnapshot()
 		if orders[i].Product.Image == "" {
 			orders[i].Product.Image = "/uploads/default_product.png"
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": orders})
+	c.JSON(http.StatusOK, gin.H{"data": orders, "next_cursor": nextCursor})
 }
 
 // Pay 模拟支付
@@ -136,16 +161,85 @@ func (o *OrderController) Pay(c *gin.Context) {
 		return
 	}
 
-	// 更新为待发货 (2)
-	config.DB.Model(&order).Update("status", 2)
+	// 下单后被卖家拉黑的，不能再付款
+	if privacyService.IsBlocked(order.SellerID, order.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "卖家已将你拉黑，无法支付，请取消订单"})
+		return
+	}
+
+	// 更新为待发货 (2)，记录实付金额；属于结算单的子订单同步刷新结算单
+	tx := config.DB.Begin()
+	if err := tx.Model(&order).Updates(map[string]interface{}{"status": 2, "paid_amount": order.Price}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "支付失败"})
+		return
+	}
+	if err := refreshCheckout(tx, order.CheckoutID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "支付失败"})
+		return
+	}
+	tx.Commit()
 	c.JSON(http.StatusOK, gin.H{"message": "支付成功"})
 }
 
+// Cancel 买家取消订单 (待支付或待发货)
+// 结算单中的子订单可以单独取消，其余子订单照常进行；已支付的金额计入退款
+func (o *OrderController) Cancel(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	tx := config.DB.Begin()
+
+	var order models.Order
+	if err := tx.Preload("Items").First(&order, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	if order.UserID != userID.(uint) {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作此订单"})
+		return
+	}
+	if order.Status != 1 && order.Status != 2 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已发货或已结束，无法取消"})
+		return
+	}
+
+	// 1. 订单置为已取消 (5)
+	if err := tx.Model(&order).Update("status", 5).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消失败"})
+		return
+	}
+
+	// 2. 订单内的商品全部重新上架 (1)
+	if err := tx.Model(&models.Product{}).Where("id IN ? AND status = ?", order.ProductIDs(), 2).Update("status", 1).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消失败"})
+		return
+	}
+
+	// 3. 刷新所属结算单
+	if err := refreshCheckout(tx, order.CheckoutID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消失败"})
+		return
+	}
+
+	tx.Commit()
+	c.JSON(http.StatusOK, gin.H{"message": "订单已取消", "refund_amount": order.PaidAmount})
+}
+
 // BatchCreate 购物车批量结算 (★★★ 核心修复实现 ★★★)
 func (o *OrderController) BatchCreate(c *gin.Context) {
 	// 1. 定义接收格式
 	var input struct {
-		CartIDs []uint `json:"cart_ids"` // 前端传来的购物车ID数组
+		CartIDs            []uint           `json:"cart_ids"`             // 前端传来的购物车ID数组
+		ConfirmPriceChange bool             `json:"confirm_price_change"` // 用户已确认按新价格购买
+		ExpectedPrices     map[uint]float64 `json:"expected_prices"`      // 用户确认时看到的价格 (购物车ID -> 价格)
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
@@ -163,13 +257,28 @@ func (o *OrderController) BatchCreate(c *gin.Context) {
 	// 2. 开启事务 (Transaction)
 	tx := config.DB.Begin()
 
+	// 先创建结算单 (父订单)，子订单都挂在它下面
+	checkout := models.Checkout{
+		CheckoutNo: generateCheckoutNo(uid),
+		UserID:     uid,
+		Status:     1, // 待支付
+	}
+	if err := tx.Create(&checkout).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建结算单失败"})
+		return
+	}
+
 	// 准备一个数组存放生成的订单，用于返回给前端
+	// 同一卖家的商品合并为一个子订单，每件商品一条明细
 	var createdOrders []models.Order
+	orderIndex := make(map[uint]int) // 卖家ID -> createdOrders 下标
+	var soldProducts []models.Product
 
 	for _, cartID := range input.CartIDs {
 		// A. 查找购物车记录 (确保是自己的)
 		var cartItem models.Cart
-		if err := tx.Preload("Product").Where("id = ? AND user_id = ?", cartID, uid).First(&cartItem).Error; err != nil {
+		if err := tx.Preload("Product").Preload("Product.User").Where("id = ? AND user_id = ?", cartID, uid).First(&cartItem).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusNotFound, gin.H{"error": "购物车记录不存在或已删除"})
 			return
@@ -182,29 +291,52 @@ func (o *OrderController) BatchCreate(c *gin.Context) {
 			return
 		}
 
+		// B2. 价格变动需用户确认后才能结算
+		// 确认时须带上看到的价格，确认之后卖家又改价的仍然拒绝，不能凭一个开关按任意价格成交
+		expected, hasExpected := input.ExpectedPrices[cartID]
+		changed := cartItem.Product.Price != cartItem.AddedPrice
+		if (hasExpected && expected != cartItem.Product.Price) ||
+			(changed && (!input.ConfirmPriceChange || !hasExpected)) {
+			tx.Rollback()
+			cartItem.Revalidate()
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "商品 [" + cartItem.Product.Name + "] 价格已变动，请确认后再结算",
+				"data":  cartItem,
+			})
+			return
+		}
+
 		// C. 防自己买自己
 		if cartItem.Product.UserID == uid {
 			tx.Rollback()
 			c.JSON(http.StatusBadRequest, gin.H{"error": "不能购买自己的商品"})
 			return
 		}
-
-		// D. 创建订单
-		order := models.Order{
-			OrderNo:   generateOrderNo() + strconv.Itoa(int(cartID)), // 防止高并发下订单号冲突
-			UserID:    uid,
-			SellerID:  cartItem.Product.UserID,
-			ProductID: cartItem.Product.ID,
-			Price:     cartItem.Product.Price,
-			Status:    1, // 待支付
-		}
-
-		if err := tx.Create(&order).Error; err != nil {
+		if privacyService.IsBlocked(cartItem.Product.UserID, uid) {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
+			c.JSON(http.StatusForbidden, gin.H{"error": "商品 [" + cartItem.Product.Name + "] 的卖家已将你拉黑，无法购买"})
 			return
 		}
-		createdOrders = append(createdOrders, order)
+
+		// D. 归入该卖家的子订单，第一件商品作为订单的展示商品
+		i, ok := orderIndex[cartItem.Product.UserID]
+		if !ok {
+			i = len(createdOrders)
+			orderIndex[cartItem.Product.UserID] = i
+			createdOrders = append(createdOrders, models.Order{
+				OrderNo:    generateOrderNo() + strconv.Itoa(int(cartID)), // 防止高并发下订单号冲突
+				UserID:     uid,
+				SellerID:   cartItem.Product.UserID,
+				ProductID:  cartItem.Product.ID,
+				Status:     1, // 待支付
+				Snapshot:   models.NewOrderSnapshot(cartItem.Product),
+				CheckoutID: checkout.ID,
+			})
+		}
+		createdOrders[i].Items = append(createdOrders[i].Items, models.NewOrderItem(cartItem.Product))
+		createdOrders[i].Price += cartItem.Product.Price
+		checkout.TotalAmount += cartItem.Product.Price
+		soldProducts = append(soldProducts, cartItem.Product)
 
 		// E. 标记商品为已售出 (2)
 		if err := tx.Model(&cartItem.Product).Update("status", 2).Error; err != nil {
@@ -221,12 +353,40 @@ func (o *OrderController) BatchCreate(c *gin.Context) {
 		}
 	}
 
-	// 3. 提交事务
+	// G. 创建子订单 (明细随订单一起写入)
+	for i := range createdOrders {
+		if err := tx.Create(&createdOrders[i]).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订单失败"})
+			return
+		}
+	}
+
+	// 3. 回写结算单总额并提交事务
+	if err := tx.Model(&checkout).Update("total_amount", checkout.TotalAmount).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建结算单失败"})
+		return
+	}
 	tx.Commit()
 
-	c.JSON(http.StatusOK, gin.H{"message": "结算成功", "data": createdOrders})
+	// 4. 通知其他收藏者：商品即将售出
+	if o.Notifier != nil {
+		for _, product := range soldProducts {
+			o.Notifier.NotifyAlmostSold(product, uid)
+		}
+	}
+
+	checkout.Orders = createdOrders
+	c.JSON(http.StatusOK, gin.H{"message": "结算成功", "data": createdOrders, "checkout": checkout})
 }
 
 func generateOrderNo() string {
 	return time.Now().Format("20060102150405") + "001"
 }
+
+// generateCheckoutNo 结算单号：CK + 时间(毫秒) + 用户ID
+func generateCheckoutNo(uid uint) string {
+	now := time.Now()
+	return "CK" + now.Format("20060102150405") + fmt.Sprintf("%03d", now.Nanosecond()/1e6) + strconv.Itoa(int(uid))
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"gotest/config"
+	"gotest/internal/models"
+	"gotest/internal/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxExportRows 单次导出的订单数上限，超出时要求缩小日期范围
+const maxExportRows = 5000
+
+// 导出表头
+var orderExportHeader = []string{"订单号", "商品", "价格", "状态", "买家", "卖家", "下单时间", "更新时间"}
+
+// applyOrderFilters 按 role / start_date / end_date / status 过滤订单
+// role=seller 查我卖出的，其余查我买到的；日期格式 2006-01-02，结束日期包含当天
+func applyOrderFilters(db *gorm.DB, c *gin.Context, uid uint) (*gorm.DB, error) {
+	if c.Query("role") == "seller" {
+		db = db.Where("orders.seller_id = ?", uid)
+	} else {
+		db = db.Where("orders.user_id = ?", uid)
+	}
+
+	if s := c.Query("start_date"); s != "" {
+		start, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return nil, errors.New("开始日期格式错误")
+		}
+		db = db.Where("orders.created_at >= ?", start)
+	}
+	if s := c.Query("end_date"); s != "" {
+		end, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return nil, errors.New("结束日期格式错误")
+		}
+		db = db.Where("orders.created_at < ?", end.AddDate(0, 0, 1))
+	}
+	if s := c.Query("status"); s != "" {
+		status, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.New("订单状态参数错误")
+		}
+		db = db.Where("orders.status = ?", status)
+	}
+	return db, nil
+}
+
+// Export 导出订单记录 (format=csv|xlsx，默认 csv)
+func (o *OrderController) Export(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	uid := userID.(uint)
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持 csv 或 xlsx 格式"})
+		return
+	}
+
+	db, err := applyOrderFilters(config.DB.Preload("Product").Preload("User").Preload("Seller").Preload("Items"), c, uid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var orders []models.Order
+	if err := db.Order("created_at desc").Limit(maxExportRows + 1).Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订单失败"})
+		return
+	}
+	if len(orders) > maxExportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("一次最多导出 %d 条订单，请缩小日期范围", maxExportRows)})
+		return
+	}
+
+	filename := fmt.Sprintf("orders_%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	if format == "xlsx" {
+		rows := [][]interface{}{}
+		header := make([]interface{}, len(orderExportHeader))
+		for i, h := range orderExportHeader {
+			header[i] = h
+		}
+		rows = append(rows, header)
+		for _, order := range orders {
+			order.ApplySnapshot()
+			rows = append(rows, []interface{}{
+				order.OrderNo, utils.SpreadsheetText(order.ItemNames()), order.Price, order.StatusText(),
+				utils.SpreadsheetText(displayName(order.User)), utils.SpreadsheetText(displayName(order.Seller)),
+				order.CreatedAt.Format("2006-01-02 15:04:05"), order.UpdatedAt.Format("2006-01-02 15:04:05"),
+			})
+		}
+		data, err := utils.BuildXLSX("订单", rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+			return
+		}
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", data)
+		return
+	}
+
+	var buf bytes.Buffer
+	// 写入 UTF-8 BOM，避免 Excel 打开中文乱码
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	w.Write(orderExportHeader)
+	for _, order := range orders {
+		order.ApplySnapshot()
+		w.Write([]string{
+			order.OrderNo, utils.SpreadsheetText(order.ItemNames()), strconv.FormatFloat(order.Price, 'f', 2, 64), order.StatusText(),
+			utils.SpreadsheetText(displayName(order.User)), utils.SpreadsheetText(displayName(order.Seller)),
+			order.CreatedAt.Format("2006-01-02 15:04:05"), order.UpdatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	w.Flush()
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// Receipt 生成单个订单的 PDF 收据 (仅买卖双方可查看)
+func (o *OrderController) Receipt(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("userID")
+	uid := userID.(uint)
+
+	var order models.Order
+	if err := config.DB.Preload("Product").Preload("User").Preload("Seller").Preload("Items").First(&order, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	if order.UserID != uid && order.SellerID != uid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看此订单"})
+		return
+	}
+	order.ApplySnapshot()
+
+	doc := utils.NewPDF()
+	doc.AddLine("闲趣 交易收据", 20)
+	doc.AddBlank()
+	doc.AddLine("订单号："+order.OrderNo, 12)
+	doc.AddLine("订单状态："+order.StatusText(), 12)
+	doc.AddLine("买家："+displayName(order.User), 12)
+	doc.AddLine("卖家："+displayName(order.Seller), 12)
+	doc.AddBlank()
+	if len(order.Items) > 1 {
+		// 同一卖家的多件商品逐件列出
+		for _, item := range order.Items {
+			doc.AddLine(fmt.Sprintf("商品：%s  ¥%.2f", item.Snapshot.Name, item.Price), 12)
+		}
+		doc.AddLine(fmt.Sprintf("合计：¥%.2f", order.Price), 14)
+	} else {
+		doc.AddLine("商品："+order.Product.Name, 12)
+		doc.AddLine("分类："+order.Product.Category, 12)
+		doc.AddLine("描述："+order.Product.Description, 12)
+		doc.AddLine(fmt.Sprintf("成交价格：¥%.2f", order.Price), 14)
+	}
+	doc.AddBlank()
+	doc.AddLine("下单时间："+order.CreatedAt.Format("2006-01-02 15:04:05"), 12)
+	doc.AddLine("更新时间："+order.UpdatedAt.Format("2006-01-02 15:04:05"), 12)
+	doc.AddLine("打印时间："+time.Now().Format("2006-01-02 15:04:05"), 10)
+
+	c.Header("Content-Disposition", "attachment; filename=receipt_"+order.OrderNo+".pdf")
+	c.Data(http.StatusOK, "application/pdf", doc.Bytes())
+}
+
+// displayName 优先显示昵称，没有昵称时显示用户名
+func displayName(u models.User) string {
+	if u.Nickname != "" {
+		return u.Nickname
+	}
+	return u.Username
+}
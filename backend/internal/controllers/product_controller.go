@@ -3,6 +3,8 @@ package controllers
 import (
 	"gotest/config"
 	"gotest/internal/models"
+	"gotest/internal/services"
+	"gotest/internal/utils"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,8 +13,29 @@ import (
 	"gorm.io/gorm"
 )
 
+// 分类校验与查询
+var categoryService = new(services.CategoryService)
+
+// 商品图片维护
+var productImageService = new(services.ProductImageService)
+
+// 拉黑名单 (被拉黑的用户看不到对方的商品，也不能购买)
+var privacyService = new(services.PrivacyService)
+
+// 敏感词、诈骗话术过滤
+var moderationService = new(services.ModerationService)
+
+// viewerID 当前登录用户 ID，游客为 0 (配合 middleware.OptionalAuth 使用)
+func viewerID(c *gin.Context) uint {
+	if uid, ok := c.Get("userID"); ok {
+		return uid.(uint)
+	}
+	return 0
+}
+
 type ProductController struct {
-	// 移除 Service 依赖，直接使用 config.DB
+	// 数据操作直接使用 config.DB，通知服务用于降价提醒
+	Notifier *services.NotificationService
 }
 
 // List 获取商品列表
@@ -20,28 +43,46 @@ func (p *ProductController) List(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
 	category := c.Query("category")
+	categoryID, _ := strconv.Atoi(c.Query("category_id"))
 	search := c.Query("search")
 	isRandom := c.Query("is_random") == "true"
 
+	filters, err := parseProductFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var products []models.Product
 	var total int64
 
 	db := config.DB.Model(&models.Product{})
 
 	// 1. 过滤状态：只显示在售商品
-	db = db.Where("status = ?", 1)
+	db = db.Where("products.status = ?", 1)
 
-	// 2. 搜索逻辑
-	if search != "" {
-		db = db.Where("name LIKE ? OR description LIKE ?", "%"+search+"%", "%"+search+"%")
+	// 1.1 登录用户看不到拉黑了自己的卖家的商品
+	db = privacyService.HideBlockerProducts(db, viewerID(c))
+
+	// 2. 搜索逻辑 (全文索引 + 相关度排序)
+	terms := splitSearchTerms(search)
+	rank := ""
+	if len(terms) > 0 {
+		db, rank = applySearch(db, terms)
 	}
 
-	// 3. 分类筛选
-	if category != "" && category != "全部" {
-		db = db.Where("category = ?", category)
+	// 3. 分类筛选 (按分类 ID 时包含所有子分类；按名称兼容旧前端)
+	if categoryID > 0 {
+		db = db.Where("products.category_id IN ?", categoryService.DescendantIDs(uint(categoryID)))
+	} else if category != "" && category != "全部" {
+		db = db.Where("products.category = ?", category)
 	}
 
+	// 3.1 价格、包邮、议价、卖家、发布时间筛选
+	db = filters.apply(db)
+
 	// 4. 核心逻辑
+	nextCursor := ""
 	if isRandom {
 		// ★★★ 修复点：随机推荐也要 Preload("User")，否则首页显示不出卖家头像 ★★★
 		// SQLite 使用 RANDOM()，MySQL 使用 RAND()
@@ -50,15 +91,39 @@ func (p *ProductController) List(c *gin.Context) {
 			return
 		}
 		total = int64(len(products))
-	} else {
-		// 普通分页列表
+	} else if c.Query("page") != "" {
+		// 兼容旧的页码分页 (总数反映筛选条件；默认有搜索词时按相关度排序)
 		db.Count(&total)
 		offset := (page - 1) * pageSize
+		db = filters.order(db, rank)
 		// 这里原代码已经加了 Preload("User")，保持不变
-		if err := db.Order("created_at desc").Offset(offset).Limit(pageSize).Preload("User").Find(&products).Error; err != nil {
+		if err := db.Offset(offset).Limit(pageSize).Preload("User").Find(&products).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
 			return
 		}
+	} else {
+		// 游标分页：按 (排序值, ID) 定位，翻页期间有新商品发布也不会重复
+		cursor, err := utils.ParseCursorPage(c, pageSize, 100)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		db.Count(&total)
+
+		sort := filters.sort(rank)
+		if sort.Expr != "" {
+			db = db.Select("products.*, " + sort.Expr + " AS sort_value")
+		}
+		if err := cursor.Apply(db, sort.Expr, sort.Desc, "products.id").Preload("User").Find(&products).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取列表失败"})
+			return
+		}
+		products, nextCursor = utils.CursorResult(cursor, products, func(p models.Product) (*float64, uint) {
+			if sort.Expr == "" {
+				return nil, p.ID
+			}
+			return &p.SortValue, p.ID
+		})
 	}
 
 	// 图片路径处理 (防止前端图片裂开)
@@ -67,11 +132,15 @@ func (p *ProductController) List(c *gin.Context) {
 			products[i].Image = "/uploads/default_product.png"
 		}
 	}
+	if len(terms) > 0 {
+		highlightProducts(products, terms)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"list":  products,
-		"total": total,
-		"page":  page,
+		"list":        products,
+		"total":       total,
+		"page":        page,
+		"next_cursor": nextCursor,
 	})
 }
 
@@ -84,18 +153,42 @@ func (p *ProductController) GetDetail(c *gin.Context) {
 	config.DB.Model(&models.Product{}).Where("id = ?", id).UpdateColumn("view_count", gorm.Expr("view_count + ?", 1))
 
 	// ★★★ 核心修复：必须 Preload("User") 才能获取卖家头像和昵称 ★★★
-	if err := config.DB.Preload("User").First(&product, id).Error; err != nil {
+	if err := config.DB.Preload("User").Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order asc, id asc")
+	}).First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
+		return
+	}
+
+	// 卖家拉黑了当前用户时按不存在处理；登录用户记录浏览 (用于卖家的消息隐私设置)
+	viewer := viewerID(c)
+	if privacyService.IsBlocked(product.UserID, viewer) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
 		return
 	}
+	privacyService.RecordView(viewer, &product)
 
 	c.JSON(http.StatusOK, gin.H{"data": product})
 }
 
-// Categories 获取分类列表
+// Categories 获取启用的分类
+// 默认返回分类名称列表 (与旧版接口一致)，?tree=1 时返回带 ID 和子分类的分类树
 func (p *ProductController) Categories(c *gin.Context) {
-	categories := []string{"数码", "书籍", "生活", "服饰", "运动", "美妆", "乐器", "手游", "兼职", "其他"}
-	c.JSON(http.StatusOK, gin.H{"data": categories})
+	if c.Query("tree") == "1" {
+		tree, err := categoryService.Tree(true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分类失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": tree})
+		return
+	}
+	names, err := categoryService.Names()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分类失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": names})
 }
 
 // Create 发布商品
@@ -112,16 +205,45 @@ func (p *ProductController) Create(c *gin.Context) {
 		return
 	}
 
+	// 校验分类 (支持传 category_id 或分类名称)
+	cat, err := categoryService.Resolve(input.CategoryID, input.Category)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.CategoryID = cat.ID
+	input.Category = cat.Name
+
+	// 名称和描述过内容过滤 (打码 / 拒绝)
+	review, err := moderationService.ReviewProduct(&input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 绑定当前登录用户 ID
 	input.UserID = userID.(uint)
 	input.Status = 1
 	input.CreatedAt = time.Now()
 	input.UpdatedAt = time.Now()
+	// 图片只能通过 image_ids 设置
+	input.Images = nil
 
-	if err := config.DB.Create(&input).Error; err != nil {
+	tx := config.DB.Begin()
+	if err := tx.Create(&input).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "发布失败: " + err.Error()})
 		return
 	}
+	if input.ImageIDs != nil {
+		if err := productImageService.SetImages(tx, &input, input.UserID, input.ImageIDs, input.CoverImageID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	tx.Commit()
+	moderationService.FlagProduct(&input, review)
 
 	c.JSON(http.StatusOK, gin.H{"message": "发布成功", "data": input})
 }
@@ -149,10 +271,102 @@ func (p *ProductController) Update(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Model(&product).Updates(input).Error; err != nil {
+	// 修改了分类时重新校验
+	if input.CategoryID != 0 || input.Category != "" {
+		cat, err := categoryService.Resolve(input.CategoryID, input.Category)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.CategoryID = cat.ID
+		input.Category = cat.Name
+	}
+
+	// 修改了名称或描述时重新过内容过滤
+	review, err := moderationService.ReviewProduct(&input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.Images = nil
+
+	oldPrice := product.Price
+	tx := config.DB.Begin()
+	if err := tx.Model(&product).Updates(input).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
+	// 传了 image_ids 时按新顺序替换全部图片
+	if input.ImageIDs != nil {
+		if err := productImageService.SetImages(tx, &product, product.UserID, input.ImageIDs, input.CoverImageID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	tx.Commit()
+	moderationService.FlagProduct(&product, review)
+
+	// 降价时通知收藏者
+	if input.Price > 0 && input.Price < oldPrice && p.Notifier != nil {
+		product.Price = input.Price
+		p.Notifier.NotifyPriceDrop(product, oldPrice)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "更新成功", "data": product})
 }
+
+// Delete 删除商品 (仅发布者)，同时清理图片、收藏和购物车记录
+// 已产生订单的商品不能删除，只能下架
+func (p *ProductController) Delete(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var product models.Product
+	if err := config.DB.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
+		return
+	}
+	if product.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权删除此商品"})
+		return
+	}
+
+	var orderCount int64
+	config.DB.Model(&models.Order{}).Where("product_id = ?", product.ID).Count(&orderCount)
+	if orderCount == 0 {
+		// 合并订单中非首件的商品只记录在订单明细里
+		config.DB.Model(&models.OrderItem{}).Where("product_id = ?", product.ID).Count(&orderCount)
+	}
+	if orderCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该商品已有订单，不能删除，请改为下架"})
+		return
+	}
+
+	tx := config.DB.Begin()
+	if err := productImageService.DeleteImages(tx, product.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	if err := tx.Where("product_id = ?", product.ID).Delete(&models.Cart{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	if err := tx.Where("product_id = ?", product.ID).Delete(&models.Favorite{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	if err := tx.Delete(&product).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// productSort 排序方式：排序表达式 + 方向，表达式为空表示只按 ID (即发布先后) 排序
+type productSort struct {
+	Expr string
+	Desc bool
+}
+
+// 商品列表支持的排序方式
+var productSorts = map[string]productSort{
+	"newest":         {"", true},
+	"price_asc":      {"products.price", false},
+	"price_desc":     {"products.price", true},
+	"most_viewed":    {"products.view_count", true},
+	"most_favorited": {"(SELECT COUNT(*) FROM favorites WHERE favorites.product_id = products.id)", true},
+}
+
+// productFilters 商品列表的筛选条件 (均为可选，可任意组合)
+type productFilters struct {
+	MinPrice     *float64
+	MaxPrice     *float64
+	FreeShipping *bool
+	Negotiable   *bool
+	SellerID     uint
+	PostedWithin int    // 最近 N 天内发布
+	Sort         string // 见 productSorts，另有 relevance (仅搜索时可用)
+}
+
+// parseProductFilters 解析并校验筛选参数
+func parseProductFilters(c *gin.Context) (productFilters, error) {
+	var f productFilters
+
+	if s := c.Query("min_price"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			return f, errors.New("最低价格参数错误")
+		}
+		f.MinPrice = &v
+	}
+	if s := c.Query("max_price"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			return f, errors.New("最高价格参数错误")
+		}
+		f.MaxPrice = &v
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return f, errors.New("最低价格不能高于最高价格")
+	}
+
+	if s := c.Query("free_shipping"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return f, errors.New("包邮参数错误")
+		}
+		f.FreeShipping = &v
+	}
+	if s := c.Query("negotiable"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return f, errors.New("可议价参数错误")
+		}
+		f.Negotiable = &v
+	}
+
+	if s := c.Query("seller_id"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return f, errors.New("卖家参数错误")
+		}
+		f.SellerID = uint(v)
+	}
+
+	if s := c.Query("posted_within"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > 365 {
+			return f, errors.New("发布时间参数错误，应为 1-365 天")
+		}
+		f.PostedWithin = v
+	}
+
+	f.Sort = c.Query("sort")
+	if _, ok := productSorts[f.Sort]; !ok && f.Sort != "" && f.Sort != "relevance" {
+		return f, errors.New("不支持的排序方式")
+	}
+
+	return f, nil
+}
+
+// apply 将筛选条件加到查询上
+func (f productFilters) apply(db *gorm.DB) *gorm.DB {
+	if f.MinPrice != nil {
+		db = db.Where("products.price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		db = db.Where("products.price <= ?", *f.MaxPrice)
+	}
+	if f.FreeShipping != nil {
+		db = db.Where("products.is_free_shipping = ?", *f.FreeShipping)
+	}
+	if f.Negotiable != nil {
+		db = db.Where("products.is_negotiable = ?", *f.Negotiable)
+	}
+	if f.SellerID != 0 {
+		db = db.Where("products.user_id = ?", f.SellerID)
+	}
+	if f.PostedWithin > 0 {
+		db = db.Where("products.created_at >= ?", time.Now().AddDate(0, 0, -f.PostedWithin))
+	}
+	return db
+}
+
+// sort 确定排序方式；rank 为搜索相关度表达式 (分数越小越相关)，没有搜索词时为空
+// 未指定排序时：搜索按相关度，否则按最新发布
+func (f productFilters) sort(rank string) productSort {
+	if s, ok := productSorts[f.Sort]; ok {
+		return s
+	}
+	if rank != "" {
+		return productSort{rank, false}
+	}
+	return productSorts["newest"]
+}
+
+// order 页码分页时应用排序，最后按 ID 兜底保证顺序稳定
+// 显式选出 products.*：搜索时有 JOIN，GORM 会按模型字段逐列选取，查询不存在的 sort_value 列
+func (f productFilters) order(db *gorm.DB, rank string) *gorm.DB {
+	s := f.sort(rank)
+	db = db.Select("products.*")
+	if s.Expr != "" {
+		dir := "asc"
+		if s.Desc {
+			dir = "desc"
+		}
+		db = db.Order(s.Expr + " " + dir)
+	}
+	return db.Order("products.id desc")
+}
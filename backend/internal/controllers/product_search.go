@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"gotest/internal/models"
+	"gotest/internal/utils"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// splitSearchTerms 按空白拆分搜索词并去重
+func splitSearchTerms(search string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range strings.Fields(search) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// applySearch 对商品查询应用全文检索，返回相关度排序表达式 (值越小越相关)
+// trigram 分词至少需要 3 个字符，长度 >= 3 的词走 FTS5 MATCH 并用 bm25 打分 (名称权重更高)；
+// 更短的词 (如 "电脑"、"书") 退回 LIKE 匹配，按命中位置打分：名称命中 10 分、描述命中 1 分，
+// 取负数与 bm25 同向，两种词同时存在时分数相加
+func applySearch(db *gorm.DB, terms []string) (*gorm.DB, string) {
+	var phrases, scores, conds []string
+	var scoreArgs, condArgs []interface{}
+	for _, t := range terms {
+		if utf8.RuneCountInString(t) >= 3 {
+			phrases = append(phrases, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+		} else {
+			like := "%" + t + "%"
+			scores = append(scores, "(CASE WHEN name LIKE ? THEN 10.0 ELSE 0 END + CASE WHEN description LIKE ? THEN 1.0 ELSE 0 END)")
+			scoreArgs = append(scoreArgs, like, like)
+			conds = append(conds, "(name LIKE ? OR description LIKE ?)")
+			condArgs = append(condArgs, like, like)
+		}
+	}
+
+	var rank []string
+	if len(phrases) > 0 {
+		db = db.Joins(
+			"JOIN (SELECT rowid, bm25(products_fts, 10.0, 1.0) AS rank FROM products_fts WHERE products_fts MATCH ?) AS fts ON fts.rowid = products.id",
+			strings.Join(phrases, " "),
+		)
+		rank = append(rank, "fts.rank")
+	}
+	if len(scores) > 0 {
+		db = db.Joins(
+			"JOIN (SELECT id, -("+strings.Join(scores, " + ")+") AS score FROM products WHERE "+strings.Join(conds, " AND ")+") AS lk ON lk.id = products.id",
+			append(scoreArgs, condArgs...)...,
+		)
+		rank = append(rank, "lk.score")
+	}
+	return db, strings.Join(rank, " + ")
+}
+
+// highlightProducts 为搜索结果生成高亮的名称和描述片段
+func highlightProducts(products []models.Product, terms []string) {
+	for i := range products {
+		products[i].Highlight = &models.SearchHighlight{
+			Name:    utils.Highlight(products[i].Name, terms),
+			Snippet: utils.Snippet(products[i].Description, terms, 30),
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"errors"
 	"gotest/config"
 	"gotest/internal/middleware" // 确保导入了 middleware 包
 	"gotest/internal/models"
+	"gotest/internal/services"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type UserController struct{}
@@ -118,9 +122,15 @@ func (u *UserController) GetMyData(c *gin.Context) {
 		}
 		c.JSON(http.StatusOK, gin.H{"data": products})
 	} else {
-		// 获取我的收藏
+		// 获取我的收藏 (附带商品是否还在售、是否降价)
 		var favorites []models.Favorite
-		config.DB.Preload("Product").Where("user_id = ?", uid).Find(&favorites)
+		config.DB.Preload("Product").Where("user_id = ?", uid).Order("created_at desc").Find(&favorites)
+		for i := range favorites {
+			favorites[i].Revalidate()
+			if favorites[i].Product.Image == "" {
+				favorites[i].Product.Image = "/uploads/default_product.png"
+			}
+		}
 		c.JSON(http.StatusOK, gin.H{"data": favorites})
 	}
 }
@@ -196,7 +206,13 @@ func (u *UserController) ToggleFavorite(c *gin.Context) {
 		config.DB.Delete(&fav)
 		c.JSON(http.StatusOK, gin.H{"message": "已取消"})
 	} else {
-		config.DB.Create(&models.Favorite{UserID: userID.(uint), ProductID: input.ProductID})
+		// 记录收藏时的价格，用于降价提醒
+		var product models.Product
+		if err := config.DB.First(&product, input.ProductID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "商品不存在"})
+			return
+		}
+		config.DB.Create(&models.Favorite{UserID: userID.(uint), ProductID: input.ProductID, FavoritedPrice: product.Price})
 		c.JSON(http.StatusOK, gin.H{"message": "已收藏"})
 	}
 }
@@ -212,22 +228,113 @@ func (u *UserController) CheckFavorite(c *gin.Context) {
 
 // ★★★ 新增：GetUserInfo 获取指定用户的公开信息 ★★★
 // 这就是修复“用户5”显示问题的关键接口
+// 对方拉黑了自己时按不存在处理；没有聊过天或交易过的用户只能看到打码的用户名
 func (u *UserController) GetUserInfo(c *gin.Context) {
 	id := c.Param("id")
+	uid, _ := c.Get("userID")
+	viewer := uid.(uint)
 	var user models.User
 
 	// 只查询必要的公开字段，保护隐私
 	result := config.DB.Select("id", "username", "nickname", "avatar").First(&user, id)
 
-	if result.Error != nil {
+	if result.Error != nil || privacyService.IsBlocked(user.ID, viewer) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
+	if !privacyService.HasContact(viewer, user.ID) {
+		user.Username = maskUsername(user.Username)
+	}
 
 	// 默认头像处理
 	if user.Avatar == "" {
 		user.Avatar = "https://cube.elemecdn.com/3/7c/3ea6beec64369c2642b92c6726f1epng.png"
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": user})
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"nickname": user.Nickname,
+		"avatar":   user.Avatar,
+		"blocked":  privacyService.IsBlocked(viewer, user.ID), // 我是否拉黑了对方
+	}})
+}
+
+// maskUsername 用户名打码，只保留首尾字符
+func maskUsername(name string) string {
+	r := []rune(name)
+	switch {
+	case len(r) <= 1:
+		return "*"
+	case len(r) == 2:
+		return string(r[0]) + "*"
+	}
+	return string(r[0]) + "***" + string(r[len(r)-1])
+}
+
+// ListBlocks 我的黑名单
+func (u *UserController) ListBlocks(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	blocks, err := privacyService.List(uid.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取黑名单失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": blocks})
+}
+
+// Block 拉黑用户：对方不能再给我发消息、购买我的商品，也看不到我发布的商品
+func (u *UserController) Block(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	var input struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	err := privacyService.Block(uid.(uint), input.UserID)
+	switch {
+	case errors.Is(err, services.ErrBlockSelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "拉黑失败"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "已拉黑"})
+	}
+}
+
+// Unblock 解除拉黑
+func (u *UserController) Unblock(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	if err := privacyService.Unblock(uid.(uint), uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已解除拉黑"})
+}
+
+// UpdatePrivacy 修改消息隐私设置 {"message_privacy": "everyone" | "known"}
+func (u *UserController) UpdatePrivacy(c *gin.Context) {
+	uid, _ := c.Get("userID")
+	var input struct {
+		MessagePrivacy string `json:"message_privacy" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	if err := privacyService.SetMessagePrivacy(uid.(uint), input.MessagePrivacy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "设置成功", "message_privacy": input.MessagePrivacy})
 }
@@ -87,6 +87,23 @@ func Auth() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuth 可选鉴权：带了有效 Token 时写入 userID，没有或无效时按游客处理，不拦截请求
+// 用于商品列表等公开接口按登录用户做个性化过滤 (如隐藏拉黑了自己的卖家的商品)
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.GetHeader("Authorization")
+		if len(tokenString) > 7 && strings.ToUpper(tokenString[0:7]) == "BEARER " {
+			tokenString = tokenString[7:]
+		}
+		if tokenString != "" {
+			if claims, err := ParseToken(tokenString); err == nil {
+				c.Set("userID", claims.UserID)
+			}
+		}
+		c.Next()
+	}
+}
+
 // AdminAuth 管理员中间件 (目前复用普通验证，由 request.js 分离 Token)
 func AdminAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// UserBlock 拉黑关系：BlockerID 拉黑了 BlockedID
+// 被拉黑的一方不能给对方发消息、不能购买对方的商品，也看不到对方发布的商品
+type UserBlock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	BlockerID uint      `gorm:"uniqueIndex:idx_user_block;not null" json:"blocker_id"`
+	BlockedID uint      `gorm:"uniqueIndex:idx_user_block;index;not null" json:"blocked_id"`
+
+	Blocked User `gorm:"foreignKey:BlockedID" json:"blocked,omitempty"`
+}
+
+func (UserBlock) TableName() string {
+	return "user_blocks"
+}
+
+// ProductView 登录用户浏览过的商品 (每人每个商品一条，记录最近一次浏览时间)
+// 用于隐私设置“只接收浏览过我的商品或与我交易过的人的消息”
+type ProductView struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"uniqueIndex:idx_product_view;not null" json:"user_id"`
+	ProductID uint      `gorm:"uniqueIndex:idx_product_view;not null" json:"product_id"`
+	SellerID  uint      `gorm:"index;not null" json:"seller_id"`
+}
+
+func (ProductView) TableName() string {
+	return "product_views"
+}
@@ -10,11 +10,50 @@ type Cart struct {
 	// ★★★ 新增：购买数量字段 ★★★
 	Count int `gorm:"default:1" json:"count"`
 
+	// 加入购物车时的商品价格，用于检测降价/涨价
+	AddedPrice float64 `gorm:"default:0" json:"added_price"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
 	// 关联字段：预加载商品信息
 	Product Product `gorm:"foreignKey:ProductID" json:"product"`
+
+	// 以下字段不入库，由 Revalidate 根据商品最新状态计算
+	State    string  `gorm:"-" json:"state"`     // available / sold_out / removed / price_changed
+	OldPrice float64 `gorm:"-" json:"old_price"` // 价格变动时：加入时的价格
+	NewPrice float64 `gorm:"-" json:"new_price"` // 价格变动时：当前价格
+}
+
+// 购物车条目状态
+const (
+	CartStateAvailable    = "available"     // 可购买
+	CartStateSoldOut      = "sold_out"      // 已售出
+	CartStateRemoved      = "removed"       // 已下架或已删除
+	CartStatePriceChanged = "price_changed" // 价格已变动
+)
+
+// Revalidate 根据预加载的商品重新计算条目状态
+func (c *Cart) Revalidate() {
+	switch {
+	case c.Product.ID == 0 || c.Product.Status == 3:
+		c.State = CartStateRemoved
+	case c.Product.Status == 2:
+		c.State = CartStateSoldOut
+	case c.Product.Status != 1:
+		c.State = CartStateRemoved
+	case c.AddedPrice != c.Product.Price:
+		c.State = CartStatePriceChanged
+		c.OldPrice = c.AddedPrice
+		c.NewPrice = c.Product.Price
+	default:
+		c.State = CartStateAvailable
+	}
+}
+
+// IsInvalid 已售出或已下架的条目无法再购买
+func (c *Cart) IsInvalid() bool {
+	return c.State == CartStateSoldOut || c.State == CartStateRemoved
 }
 
 // TableName 指定数据库表名为 carts
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Category 商品分类 (支持多级，ParentID 为 0 表示一级分类)
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"type:varchar(32);not null" json:"name"` // 同一父分类下唯一 (唯一索引见 config.uniqueCategoryNames)
+	ParentID  uint      `gorm:"index;default:0" json:"parent_id"`
+	Icon      string    `json:"icon"`
+	SortOrder int       `gorm:"default:0" json:"sort_order"` // 越小越靠前
+	Enabled   bool      `gorm:"default:true" json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 子分类，由服务层组装成树
+	Children []*Category `gorm:"-" json:"children,omitempty"`
+}
+
+func (Category) TableName() string {
+	return "categories"
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Checkout 结算单 (父订单)
+// 购物车一次结算生成一个结算单，下挂按卖家分组的子订单，整单只需支付一次
+type Checkout struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	CheckoutNo   string     `json:"checkout_no" gorm:"unique"` // 结算单号
+	UserID       uint       `json:"user_id" gorm:"index"`      // 买家ID
+	TotalAmount  float64    `json:"total_amount"`              // 应付总额 (不含已取消子订单)
+	PaidAmount   float64    `json:"paid_amount"`               // 实付总额
+	RefundAmount float64    `json:"refund_amount"`             // 已退款总额 (支付后取消的子订单)
+	Status       int        `json:"status" gorm:"default:1"`   // 1:待支付 2:已支付 5:已取消
+	PaidAt       *time.Time `json:"paid_at"`                   // 支付时间
+
+	// 子订单由控制器手动加载，不建外键约束
+	Orders []Order `json:"orders" gorm:"-"`
+}
+
+func (Checkout) TableName() string {
+	return "checkouts"
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Conversation 两个用户之间的会话
+// 从商品详情页发起的咨询关联该商品，同一对用户就不同商品的聊天是不同的会话；ProductID 为 0 表示普通私聊
+// 参与者按 ID 从小到大存为 A / B，未读数和已读位置按参与者分别记录
+type Conversation struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserAID   uint `gorm:"uniqueIndex:idx_conversation_pair;not null" json:"user_a_id"` // 较小的用户 ID
+	UserBID   uint `gorm:"uniqueIndex:idx_conversation_pair;not null" json:"user_b_id"` // 较大的用户 ID
+	ProductID uint `gorm:"uniqueIndex:idx_conversation_pair;default:0" json:"product_id"`
+
+	// 最后一条消息 (联系人列表直接展示，不再扫描消息表)
+	LastMessageID   uint      `gorm:"index;default:0" json:"last_message_id"`
+	LastSenderID    uint      `gorm:"default:0" json:"last_sender_id"`
+	LastMessageType int       `gorm:"default:0" json:"last_message_type"`
+	LastMessage     string    `json:"last_message"`
+	LastMessageAt   time.Time `json:"last_message_at"`
+
+	// 各参与者的未读数和最后已读的消息 ID
+	UnreadA   int  `gorm:"default:0" json:"unread_a"`
+	UnreadB   int  `gorm:"default:0" json:"unread_b"`
+	LastReadA uint `gorm:"default:0" json:"last_read_a"`
+	LastReadB uint `gorm:"default:0" json:"last_read_b"`
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// ConversationPair 按 ID 从小到大排列会话参与者
+func ConversationPair(a, b uint) (uint, uint) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
+
+// Has 用户是否为会话参与者
+func (c *Conversation) Has(userID uint) bool {
+	return c.UserAID == userID || c.UserBID == userID
+}
+
+// PeerOf 会话中的另一方
+func (c *Conversation) PeerOf(userID uint) uint {
+	if c.UserAID == userID {
+		return c.UserBID
+	}
+	return c.UserAID
+}
+
+// UnreadColumn / LastReadColumn 用户对应的未读数和已读位置字段
+func (c *Conversation) UnreadColumn(userID uint) string {
+	if c.UserAID == userID {
+		return "unread_a"
+	}
+	return "unread_b"
+}
+
+func (c *Conversation) LastReadColumn(userID uint) string {
+	if c.UserAID == userID {
+		return "last_read_a"
+	}
+	return "last_read_b"
+}
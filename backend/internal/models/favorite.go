@@ -8,7 +8,32 @@ type Favorite struct {
 	ProductID uint      `gorm:"not null" json:"product_id"`
 	CreatedAt time.Time `json:"created_at"`
 
+	// 收藏时的商品价格，用于降价提醒
+	FavoritedPrice float64 `gorm:"default:0" json:"favorited_price"`
+
 	Product Product `gorm:"foreignKey:ProductID" json:"product"`
+
+	// 不入库，由 Revalidate 根据商品最新状态计算
+	State string `gorm:"-" json:"state"` // available / sold_out / removed / price_dropped
+}
+
+// 收藏状态 (可购买、售出、下架沿用购物车的状态值)
+const FavoriteStatePriceDropped = "price_dropped"
+
+// Revalidate 根据预加载的商品计算收藏条目的可用状态
+func (f *Favorite) Revalidate() {
+	switch {
+	case f.Product.ID == 0 || f.Product.Status == 3:
+		f.State = CartStateRemoved
+	case f.Product.Status == 2:
+		f.State = CartStateSoldOut
+	case f.Product.Status != 1:
+		f.State = CartStateRemoved
+	case f.Product.Price < f.FavoritedPrice:
+		f.State = FavoriteStatePriceDropped
+	default:
+		f.State = CartStateAvailable
+	}
 }
 
 func (Favorite) TableName() string { return "favorites" }
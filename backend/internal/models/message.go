@@ -12,14 +12,45 @@ type Message struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// 所属会话 (区分同一对用户就不同商品的聊天)
+	ConversationID uint `gorm:"index;default:0" json:"conversation_id"`
+
 	// ★★★ 核心修复：添加 json 标签，强制转为小写 ★★★
 	SenderID   uint   `json:"sender_id"`
 	ReceiverID uint   `json:"receiver_id"`
 	Content    string `json:"content"` // 这里的 json:"content" 让前端能读到 msg.content
 	Type       int    `json:"type"`    // 1:文本 2:图片
 	IsRead     bool   `json:"is_read" gorm:"default:false"`
+
+	// 客户端生成的消息 ID，用于重发去重
+	ClientMsgID string `gorm:"index" json:"client_msg_id,omitempty"`
+
+	// 撤回时间；撤回后内容替换为占位文字，原内容不再保留
+	RecalledAt *time.Time `json:"recalled_at,omitempty"`
+
+	// 发送者提交的原文 (不存库)：存库前的检查可能已打码 Content，存库后的审核要看原文
+	OriginalContent string `gorm:"-" json:"-"`
 }
 
+// MessageRecalledText 撤回消息的占位文字
+const MessageRecalledText = "消息已撤回"
+
+// MessageRemovedText 被管理员判定违规的消息的占位文字
+const MessageRemovedText = "该消息因违规已被屏蔽"
+
 func (Message) TableName() string {
 	return "messages"
 }
+
+// MessageDeletion 用户从自己的聊天记录中删除的消息 (只对自己隐藏，对方不受影响)
+// 双方都删除后消息本身才软删除
+type MessageDeletion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"uniqueIndex:idx_message_deletion;not null" json:"user_id"`
+	MessageID uint      `gorm:"uniqueIndex:idx_message_deletion;not null" json:"message_id"`
+}
+
+func (MessageDeletion) TableName() string {
+	return "message_deletions"
+}
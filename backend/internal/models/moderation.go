@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// ModerationRule 内容过滤规则 (管理员维护)，作用于商品名称/描述和聊天文字消息
+type ModerationRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Pattern string `gorm:"not null" json:"pattern"` // 关键词或正则表达式
+	IsRegex bool   `gorm:"default:false" json:"is_regex"`
+	Action  string `gorm:"not null" json:"action"` // mask:打码 block:拒绝发布 flag:进入审核队列
+	Enabled bool   `gorm:"default:true" json:"enabled"`
+	Note    string `json:"note"` // 备注 (如规则来源、针对的诈骗话术)
+}
+
+func (ModerationRule) TableName() string {
+	return "moderation_rules"
+}
+
+// 审核记录的对象类型
+const (
+	FlagTargetProduct = "product"
+	FlagTargetMessage = "message"
+)
+
+// 审核状态
+const (
+	FlagPending  = "pending"  // 待审核
+	FlagApproved = "approved" // 审核通过，内容保留
+	FlagRejected = "rejected" // 违规：商品下架 / 消息屏蔽
+)
+
+// ModerationFlag 命中 flag 规则、等待人工审核的内容
+type ModerationFlag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	TargetType string `gorm:"index:idx_flag_target;not null" json:"target_type"` // product / message
+	TargetID   uint   `gorm:"index:idx_flag_target;not null" json:"target_id"`
+	UserID     uint   `gorm:"index" json:"user_id"` // 发布者
+	User       User   `gorm:"foreignKey:UserID" json:"user"`
+
+	Content string `json:"content"` // 提交时的内容快照
+	Matched string `json:"matched"` // 命中的词，逗号分隔
+
+	Status     string     `gorm:"index;default:'pending'" json:"status"`
+	ReviewerID uint       `gorm:"default:0" json:"reviewer_id"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+}
+
+func (ModerationFlag) TableName() string {
+	return "moderation_flags"
+}
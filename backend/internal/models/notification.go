@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Notification 站内通知
+type Notification struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint   `gorm:"index;not null" json:"user_id"` // 接收者
+	Type      string `gorm:"type:varchar(32)" json:"type"`  // 通知类型，见下方常量
+	Title     string `json:"title"`                         // 标题
+	Content   string `json:"content"`                       // 正文
+	ProductID uint   `json:"product_id"`                    // 关联商品 (可为 0)
+	IsRead    bool   `gorm:"default:false" json:"is_read"`  // 是否已读
+}
+
+// 通知类型
+const (
+	NotificationPriceDrop  = "price_drop"  // 收藏的商品降价
+	NotificationAlmostSold = "almost_sold" // 收藏的商品已被下单，即将售出
+)
+
+func (Notification) TableName() string {
+	return "notifications"
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,10 +18,20 @@ type Order struct {
 	OrderNo   string  `json:"order_no" gorm:"unique"`  // 订单号
 	UserID    uint    `json:"user_id"`                 // 买家ID
 	SellerID  uint    `json:"seller_id"`               // 卖家ID
-	ProductID uint    `json:"product_id"`              // 商品ID
-	Price     float64 `json:"price"`                   // 成交价格
+	ProductID uint    `json:"product_id"`              // 商品ID (多件商品的订单为第一件)
+	Price     float64 `json:"price"`                   // 成交价格 (多件商品的订单为合计)
 	Status    int     `json:"status" gorm:"default:1"` // 1:待支付 2:待发货 ...
 
+	// 购物车结算生成的子订单所属的结算单 (0 表示单独下单)
+	CheckoutID uint    `json:"checkout_id" gorm:"index;default:0"`
+	PaidAmount float64 `json:"paid_amount"` // 结算单支付后分摊到本订单的金额
+
+	// 下单时的商品快照：卖家之后修改或删除商品，都不影响订单里展示的内容
+	Snapshot OrderSnapshot `json:"snapshot" gorm:"embedded;embeddedPrefix:snapshot_"`
+
+	// 订单明细：购物车结算时同一卖家的商品合并为一个订单，每件商品一条明细
+	Items []OrderItem `json:"items" gorm:"foreignKey:OrderID"`
+
 	// 关联信息
 	Product Product `json:"product"`
 	User    User    `json:"user"`                              // 买家信息
@@ -30,3 +41,109 @@ type Order struct {
 func (Order) TableName() string {
 	return "orders"
 }
+
+// OrderItem 订单明细 (一件商品)
+type OrderItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	OrderID   uint          `json:"order_id" gorm:"index"`
+	ProductID uint          `json:"product_id" gorm:"index"`
+	Price     float64       `json:"price"` // 成交价格
+	Snapshot  OrderSnapshot `json:"snapshot" gorm:"embedded;embeddedPrefix:snapshot_"`
+}
+
+func (OrderItem) TableName() string {
+	return "order_items"
+}
+
+// NewOrderItem 按商品当前信息生成订单明细 (product.User 需已预加载)
+func NewOrderItem(product Product) OrderItem {
+	return OrderItem{
+		ProductID: product.ID,
+		Price:     product.Price,
+		Snapshot:  NewOrderSnapshot(product),
+	}
+}
+
+// ProductIDs 订单包含的全部商品 (Items 需已预加载)
+// 没有明细的历史订单只有 ProductID 一件商品
+func (o Order) ProductIDs() []uint {
+	if len(o.Items) == 0 {
+		return []uint{o.ProductID}
+	}
+	ids := make([]uint, len(o.Items))
+	for i, item := range o.Items {
+		ids[i] = item.ProductID
+	}
+	return ids
+}
+
+// ItemNames 订单商品名称，多件商品以顿号连接 (需先 ApplySnapshot)
+func (o Order) ItemNames() string {
+	if len(o.Items) <= 1 {
+		return o.Product.Name
+	}
+	names := make([]string, len(o.Items))
+	for i, item := range o.Items {
+		names[i] = item.Snapshot.Name
+	}
+	return strings.Join(names, "、")
+}
+
+// OrderSnapshot 订单商品快照
+type OrderSnapshot struct {
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	Image          string  `json:"image"`
+	Price          float64 `json:"price"`
+	Category       string  `json:"category"`
+	SellerNickname string  `json:"seller_nickname"`
+}
+
+// NewOrderSnapshot 根据商品当前信息生成快照 (product.User 需已预加载)
+func NewOrderSnapshot(product Product) OrderSnapshot {
+	nickname := product.User.Nickname
+	if nickname == "" {
+		nickname = product.User.Username
+	}
+	return OrderSnapshot{
+		Name:           product.Name,
+		Description:    product.Description,
+		Image:          product.Image,
+		Price:          product.Price,
+		Category:       product.Category,
+		SellerNickname: nickname,
+	}
+}
+
+// ApplySnapshot 用快照覆盖预加载的商品信息，保证列表展示的是下单时的内容
+// 没有快照的历史订单保持原样
+func (o *Order) ApplySnapshot() {
+	if o.Snapshot.Name == "" {
+		return
+	}
+	o.Product.ID = o.ProductID
+	o.Product.Name = o.Snapshot.Name
+	o.Product.Description = o.Snapshot.Description
+	o.Product.Image = o.Snapshot.Image
+	o.Product.Price = o.Snapshot.Price
+	o.Product.Category = o.Snapshot.Category
+}
+
+// 订单状态文案 (与前端 UserOrders.vue 保持一致)
+var orderStatusText = map[int]string{
+	1: "待付款",
+	2: "待发货",
+	3: "运输中",
+	4: "交易成功",
+	5: "已取消",
+}
+
+// StatusText 返回订单状态的中文描述
+func (o Order) StatusText() string {
+	if text, ok := orderStatusText[o.Status]; ok {
+		return text
+	}
+	return "未知状态"
+}
@@ -13,7 +13,9 @@ type Product struct {
 	Image       string  `gorm:"column:image" json:"image"`
 
 	// ★★★ 修改2: 显式指定 column:category ★★★
-	Category string `gorm:"column:category" json:"category"`
+	// Category 为冗余的分类名称 (兼容旧前端)，以 CategoryID 为准
+	Category   string `gorm:"column:category" json:"category"`
+	CategoryID uint   `gorm:"column:category_id;index;default:0" json:"category_id"`
 
 	Status int `gorm:"column:status;default:1" json:"status"`
 
@@ -30,7 +32,24 @@ type Product struct {
 	UpdatedAt time.Time `json:"updated_at"`
 
 	// 关联字段
-	User User `gorm:"foreignKey:UserID" json:"seller"`
+	User   User           `gorm:"foreignKey:UserID" json:"seller"`
+	Images []ProductImage `gorm:"foreignKey:ProductID" json:"images,omitempty"`
+
+	// 发布/修改时提交的图片上传 ID (按顺序) 和封面 ID，不入库
+	ImageIDs     []uint `gorm:"-" json:"image_ids,omitempty"`
+	CoverImageID uint   `gorm:"-" json:"cover_image_id,omitempty"`
+
+	// 搜索结果高亮 (不入库，仅搜索时返回)
+	Highlight *SearchHighlight `gorm:"-" json:"highlight,omitempty"`
+
+	// 游标分页时查询出的排序值 (只读，不建列)
+	SortValue float64 `gorm:"column:sort_value;->;-:migration" json:"-"`
+}
+
+// SearchHighlight 搜索命中的高亮内容，关键词用 <em></em> 包裹
+type SearchHighlight struct {
+	Name    string `json:"name"`
+	Snippet string `json:"snippet"`
 }
 
 func (Product) TableName() string {
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// ProductImage 商品图片 (一个商品最多 9 张，按 SortOrder 排序，IsCover 为封面)
+type ProductImage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	ProductID uint   `gorm:"index;not null" json:"product_id"`
+	UploadID  uint   `gorm:"index;default:0" json:"upload_id"` // 对应的上传记录 (迁移前的旧图为 0)
+	URL       string `json:"url"`
+	SortOrder int    `gorm:"default:0" json:"sort_order"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	IsCover   bool   `gorm:"default:false" json:"is_cover"`
+}
+
+// 单个商品的图片数量上限
+const MaxProductImages = 9
+
+func (ProductImage) TableName() string {
+	return "product_images"
+}
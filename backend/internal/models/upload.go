@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upload 上传文件记录
+// 相同内容 (Hash 相同) 只在存储中保存一份，多个用户上传时共享 StorageKey，各自一条记录、各自计入配额
+type Upload struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID     uint   `gorm:"index" json:"user_id"`         // 上传者
+	URL        string `json:"url"`                          // 访问地址
+	Width      int    `json:"width"`                        // 图片宽 (非图片为 0)
+	Height     int    `json:"height"`                       // 图片高
+	Size       int64  `json:"size"`                         // 文件大小 (字节，处理后)
+	Hash       string `gorm:"index" json:"hash"`            // 原始内容 SHA256
+	MimeType   string `json:"mime_type"`                    // 真实类型
+	StorageKey string `gorm:"index" json:"key"`             // 存储中的 key
+	ThumbKeys  string `gorm:"type:text" json:"-"`           // 缩略图，格式 "200:key,800:key"
+	RefCount   int    `gorm:"default:0" json:"ref_count"`   // 被商品/头像/消息引用的次数 (由清理任务定期重新统计)
+	Private    bool   `gorm:"default:false" json:"private"` // 私有附件 (聊天图片、纠纷凭证)，保存在私有存储，只能通过签名链接访问
+	Purpose    string `gorm:"size:20;index" json:"purpose"` // 上传用途，见 UploadPurpose* 常量
+
+	// 引用数变为 0 的时间，超过保留期后由清理任务删除
+	UnreferencedSince *time.Time `json:"unreferenced_since"`
+}
+
+func (Upload) TableName() string {
+	return "uploads"
+}
+
+// 上传用途
+const (
+	UploadPurposeProduct  = "product"  // 商品图片
+	UploadPurposeAvatar   = "avatar"   // 头像
+	UploadPurposeChat     = "chat"     // 聊天图片
+	UploadPurposeEvidence = "evidence" // 纠纷凭证：没有数据表引用，不参与孤儿清理
+)
+
+// Thumb 一张缩略图
+type Thumb struct {
+	Size int
+	Key  string
+}
+
+// Thumbs 解析 ThumbKeys
+func (u *Upload) Thumbs() []Thumb {
+	var thumbs []Thumb
+	for _, part := range strings.Split(u.ThumbKeys, ",") {
+		size, key, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.Atoi(size)
+		thumbs = append(thumbs, Thumb{Size: n, Key: key})
+	}
+	return thumbs
+}
+
+// SetThumbs 序列化缩略图列表到 ThumbKeys
+func (u *Upload) SetThumbs(thumbs []Thumb) {
+	parts := make([]string, len(thumbs))
+	for i, t := range thumbs {
+		parts[i] = strconv.Itoa(t.Size) + ":" + t.Key
+	}
+	u.ThumbKeys = strings.Join(parts, ",")
+}
@@ -15,11 +15,22 @@ type User struct {
 	// ★★★ 新增 Role 字段 (修复 "field Role unknown" 报错) ★★★
 	Role string `gorm:"default:'user'" json:"role"` // 角色: user 或 admin
 
-	Status    int       `gorm:"default:1" json:"status"` // 状态 1:正常 0:禁用
-	CreatedAt time.Time `json:"created_at"`              // 创建时间
-	UpdatedAt time.Time `json:"updated_at"`              // 更新时间
+	Status int `gorm:"default:1" json:"status"` // 状态 1:正常 0:禁用
+
+	LastAckMessageID uint `gorm:"default:0" json:"-"` // WebSocket 已确认收到的最大消息 ID，重连时从这里补发
+
+	MessagePrivacy string `gorm:"type:varchar(16);default:'everyone'" json:"message_privacy"` // 谁可以给我发消息，见下方常量
+
+	CreatedAt time.Time `json:"created_at"` // 创建时间
+	UpdatedAt time.Time `json:"updated_at"` // 更新时间
 }
 
+// 消息隐私设置
+const (
+	MessagePrivacyEveryone = "everyone" // 所有人 (默认)
+	MessagePrivacyKnown    = "known"    // 只接收浏览过我的商品、与我交易过或我主动联系过的人
+)
+
 // TableName 指定数据库表名为 users
 func (User) TableName() string {
 	return "users"
@@ -84,8 +84,8 @@ func (s *AdminService) GetDashboardStats() (map[string]interface{}, error) {
 	}, nil
 }
 
-// GetUserList 获取用户列表 (分页 + 搜索)
-func (s *AdminService) GetUserList(page, pageSize int, keyword string) ([]models.User, int64, error) {
+// GetUserList 获取用户列表 (游标分页 + 搜索)
+func (s *AdminService) GetUserList(cursor *utils.CursorPage, keyword string) ([]models.User, int64, string, error) {
 	var users []models.User
 	var total int64
 
@@ -98,13 +98,13 @@ func (s *AdminService) GetUserList(page, pageSize int, keyword string) ([]models
 	// 计算总数
 	db.Count(&total)
 
-	// 分页查询
-	offset := (page - 1) * pageSize
-	if err := db.Offset(offset).Limit(pageSize).Order("created_at desc").Find(&users).Error; err != nil {
-		return nil, 0, err
+	// 分页查询 (按注册先后倒序)
+	if err := cursor.Apply(db, "", true, "id").Find(&users).Error; err != nil {
+		return nil, 0, "", err
 	}
 
-	return users, total, nil
+	users, next := utils.CursorResult(cursor, users, func(u models.User) (*float64, uint) { return nil, u.ID })
+	return users, total, next, nil
 }
 
 // UpdateUserStatus 修改用户状态 (封号/解封)
@@ -114,27 +114,27 @@ func (s *AdminService) UpdateUserStatus(id uint, status int) error {
 }
 
 // GetAdminProductList 管理员获取商品列表 (包含所有状态)
-func (s *AdminService) GetAdminProductList(page, pageSize int, keyword string) ([]models.Product, int64, error) {
+func (s *AdminService) GetAdminProductList(cursor *utils.CursorPage, keyword string) ([]models.Product, int64, string, error) {
 	var products []models.Product
 	var total int64
 
 	db := config.DB.Model(&models.Product{})
 
-	// 搜索逻辑 (匹配标题或描述)
+	// 搜索逻辑 (匹配名称或描述)
 	if keyword != "" {
-		db = db.Where("title LIKE ? OR description LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+		db = db.Where("name LIKE ? OR description LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
 	}
 
 	// 计算总数
 	db.Count(&total)
 
 	// 分页查询 (预加载卖家信息)
-	offset := (page - 1) * pageSize
-	if err := db.Preload("User").Offset(offset).Limit(pageSize).Order("created_at desc").Find(&products).Error; err != nil {
-		return nil, 0, err
+	if err := cursor.Apply(db.Preload("User"), "", true, "id").Find(&products).Error; err != nil {
+		return nil, 0, "", err
 	}
 
-	return products, total, nil
+	products, next := utils.CursorResult(cursor, products, func(p models.Product) (*float64, uint) { return nil, p.ID })
+	return products, total, next, nil
 }
 
 // AuditProduct 审核商品 (修改状态)
@@ -144,7 +144,7 @@ func (s *AdminService) AuditProduct(id uint, status int) error {
 }
 
 // GetAdminOrderList 管理员获取订单列表 (包含买家、商品、卖家信息)
-func (s *AdminService) GetAdminOrderList(page, pageSize int, keyword string) ([]models.Order, int64, error) {
+func (s *AdminService) GetAdminOrderList(cursor *utils.CursorPage, keyword string) ([]models.Order, int64, string, error) {
 	var orders []models.Order
 	var total int64
 
@@ -163,11 +163,15 @@ func (s *AdminService) GetAdminOrderList(page, pageSize int, keyword string) ([]
 	// 1. Preload("User"): 加载买家信息
 	// 2. Preload("Product"): 加载商品信息
 	// 3. Preload("Product.User"): 加载商品关联的卖家信息
-	offset := (page - 1) * pageSize
-	if err := db.Preload("User").Preload("Product").Preload("Product.User").
-		Offset(offset).Limit(pageSize).Order("created_at desc").Find(&orders).Error; err != nil {
-		return nil, 0, err
+	// 4. Preload("Items"): 加载订单明细 (同一卖家多件商品)
+	db = db.Preload("User").Preload("Product").Preload("Product.User").Preload("Items")
+	if err := cursor.Apply(db, "", true, "id").Find(&orders).Error; err != nil {
+		return nil, 0, "", err
+	}
+	for i := range orders {
+		orders[i].ApplySnapshot()
 	}
 
-	return orders, total, nil
+	orders, next := utils.CursorResult(cursor, orders, func(o models.Order) (*float64, uint) { return nil, o.ID })
+	return orders, total, next, nil
 }
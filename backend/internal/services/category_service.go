@@ -0,0 +1,223 @@
+package services
+
+import (
+	"errors"
+	"gotest/config"
+	"gotest/internal/models"
+)
+
+type CategoryService struct{}
+
+// 未分类商品迁移后归入的分类
+const DefaultCategoryName = "其他"
+
+// Tree 获取分类树，onlyEnabled 为 true 时过滤掉停用分类 (及其子分类)
+func (s *CategoryService) Tree(onlyEnabled bool) ([]*models.Category, error) {
+	var list []*models.Category
+	db := config.DB.Order("sort_order asc, id asc")
+	if onlyEnabled {
+		db = db.Where("enabled = ?", true)
+	}
+	if err := db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*models.Category, len(list))
+	for _, cat := range list {
+		byID[cat.ID] = cat
+	}
+
+	roots := []*models.Category{}
+	for _, cat := range list {
+		if cat.ParentID == 0 {
+			roots = append(roots, cat)
+		} else if parent, ok := byID[cat.ParentID]; ok {
+			parent.Children = append(parent.Children, cat)
+		}
+		// 父分类被停用时，子分类不出现在树中
+	}
+	return roots, nil
+}
+
+// Names 按分类树的顺序 (先父后子) 返回启用分类的名称
+func (s *CategoryService) Names() ([]string, error) {
+	roots, err := s.Tree(true)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	var walk func(cats []*models.Category)
+	walk = func(cats []*models.Category) {
+		for _, cat := range cats {
+			names = append(names, cat.Name)
+			walk(cat.Children)
+		}
+	}
+	walk(roots)
+	return names, nil
+}
+
+// Resolve 根据分类 ID 或名称找到可用的分类 (ID 优先)，用于发布/修改商品时校验
+// 名称只在同一父分类下唯一，按名称匹配到多个分类时要求改传分类 ID
+func (s *CategoryService) Resolve(id uint, name string) (*models.Category, error) {
+	var cat models.Category
+	if id != 0 {
+		if err := config.DB.First(&cat, id).Error; err != nil {
+			return nil, errors.New("商品分类不存在")
+		}
+	} else if name != "" {
+		var matches []models.Category
+		if err := config.DB.Where("name = ?", name).Limit(2).Find(&matches).Error; err != nil || len(matches) == 0 {
+			return nil, errors.New("商品分类不存在")
+		}
+		if len(matches) > 1 {
+			return nil, errors.New("存在多个同名分类，请选择具体分类")
+		}
+		cat = matches[0]
+	} else {
+		return nil, errors.New("请选择商品分类")
+	}
+	if !cat.Enabled {
+		return nil, errors.New("该分类已停用")
+	}
+	return &cat, nil
+}
+
+// DescendantIDs 返回分类及其所有子孙分类的 ID
+func (s *CategoryService) DescendantIDs(id uint) []uint {
+	var all []models.Category
+	config.DB.Select("id", "parent_id").Find(&all)
+
+	children := make(map[uint][]uint)
+	for _, cat := range all {
+		children[cat.ParentID] = append(children[cat.ParentID], cat.ID)
+	}
+
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// CategoryInput 新建/修改分类的参数，Enabled 为空时新建默认启用、修改时保持不变
+type CategoryInput struct {
+	Name      string `json:"name"`
+	ParentID  uint   `json:"parent_id"`
+	Icon      string `json:"icon"`
+	SortOrder int    `json:"sort_order"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+// Create 新建分类
+func (s *CategoryService) Create(input CategoryInput) (*models.Category, error) {
+	if input.Name == "" {
+		return nil, errors.New("分类名称不能为空")
+	}
+	if err := s.checkParent(0, input.ParentID); err != nil {
+		return nil, err
+	}
+	if err := s.checkName(0, input.ParentID, input.Name); err != nil {
+		return nil, err
+	}
+
+	cat := models.Category{
+		Name:      input.Name,
+		ParentID:  input.ParentID,
+		Icon:      input.Icon,
+		SortOrder: input.SortOrder,
+		Enabled:   true,
+	}
+	if err := config.DB.Create(&cat).Error; err != nil {
+		return nil, err
+	}
+	// enabled 列有默认值，false 需要单独写入
+	if input.Enabled != nil && !*input.Enabled {
+		cat.Enabled = false
+		config.DB.Model(&cat).Update("enabled", false)
+	}
+	return &cat, nil
+}
+
+// Update 修改分类；改名时同步更新商品上冗余的分类名
+func (s *CategoryService) Update(id uint, input CategoryInput) (*models.Category, error) {
+	var cat models.Category
+	if err := config.DB.First(&cat, id).Error; err != nil {
+		return nil, errors.New("分类不存在")
+	}
+	if input.Name == "" {
+		return nil, errors.New("分类名称不能为空")
+	}
+	if err := s.checkParent(cat.ID, input.ParentID); err != nil {
+		return nil, err
+	}
+	if err := s.checkName(cat.ID, input.ParentID, input.Name); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":       input.Name,
+		"parent_id":  input.ParentID,
+		"icon":       input.Icon,
+		"sort_order": input.SortOrder,
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+
+	tx := config.DB.Begin()
+	if err := tx.Model(&cat).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Model(&models.Product{}).Where("category_id = ?", cat.ID).Update("category", input.Name).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	tx.Commit()
+	return &cat, nil
+}
+
+// Delete 删除分类 (有子分类或仍有商品引用时不允许删除)
+func (s *CategoryService) Delete(id uint) error {
+	var count int64
+	config.DB.Model(&models.Category{}).Where("parent_id = ?", id).Count(&count)
+	if count > 0 {
+		return errors.New("请先删除子分类")
+	}
+	config.DB.Model(&models.Product{}).Where("category_id = ?", id).Count(&count)
+	if count > 0 {
+		return errors.New("该分类下还有商品，建议停用而不是删除")
+	}
+	return config.DB.Delete(&models.Category{}, id).Error
+}
+
+// checkParent 校验父分类存在，且不会形成环 (不能挂到自己或自己的子孙下面)
+func (s *CategoryService) checkParent(selfID, parentID uint) error {
+	if parentID == 0 {
+		return nil
+	}
+	var parent models.Category
+	if err := config.DB.First(&parent, parentID).Error; err != nil {
+		return errors.New("父分类不存在")
+	}
+	if selfID == 0 {
+		return nil
+	}
+	for _, id := range s.DescendantIDs(selfID) {
+		if id == parentID {
+			return errors.New("不能把分类移动到自己或子分类下")
+		}
+	}
+	return nil
+}
+
+// checkName 同一父分类下不能重名 (数据库有 (parent_id, name) 唯一索引，这里给出可读的提示)
+func (s *CategoryService) checkName(selfID, parentID uint, name string) error {
+	var count int64
+	config.DB.Model(&models.Category{}).Where("parent_id = ? AND name = ? AND id <> ?", parentID, name, selfID).Count(&count)
+	if count > 0 {
+		return errors.New("同级分类下已有同名分类")
+	}
+	return nil
+}
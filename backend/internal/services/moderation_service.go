@@ -0,0 +1,309 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gotest/config"
+	"gotest/internal/models"
+	"gotest/internal/utils"
+	"gotest/pkg/moderation"
+	"gotest/pkg/ws"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ModerationService 敏感词、诈骗话术过滤 (商品名称/描述、聊天文字消息) 和人工审核队列
+type ModerationService struct{}
+
+// ErrContentBlocked 内容命中 block 规则，拒绝发布
+var ErrContentBlocked = errors.New("内容包含违禁信息")
+
+// 编译好的过滤器缓存：规则在后台修改后立即重建；多实例部署时其他实例最迟 moderationReloadInterval 后生效
+var moderationCache struct {
+	sync.RWMutex
+	filter   *moderation.Filter
+	loadedAt time.Time
+}
+
+const moderationReloadInterval = time.Minute
+
+// filter 当前生效的过滤器，缓存过期时从数据库重建；重建失败时沿用旧的
+func (s *ModerationService) filter() *moderation.Filter {
+	moderationCache.RLock()
+	f, fresh := moderationCache.filter, time.Since(moderationCache.loadedAt) < moderationReloadInterval
+	moderationCache.RUnlock()
+	if f != nil && fresh {
+		return f
+	}
+	if err := s.Reload(); err != nil {
+		log.Println("加载内容过滤规则失败:", err)
+	}
+	moderationCache.RLock()
+	defer moderationCache.RUnlock()
+	return moderationCache.filter
+}
+
+// Reload 从数据库重新加载启用的规则
+func (s *ModerationService) Reload() error {
+	var rows []models.ModerationRule
+	if err := config.DB.Where("enabled = ?", true).Order("id asc").Find(&rows).Error; err != nil {
+		return err
+	}
+	rules := make([]moderation.Rule, 0, len(rows))
+	for _, r := range rows {
+		rule := toRule(r)
+		// 单条坏规则 (如数据库里被手工改坏的正则) 不影响其他规则
+		if err := moderation.Validate(rule); err != nil {
+			log.Printf("跳过无效的过滤规则 %d: %v", r.ID, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	f, err := moderation.New(rules)
+	if err != nil {
+		return err
+	}
+
+	moderationCache.Lock()
+	moderationCache.filter, moderationCache.loadedAt = f, time.Now()
+	moderationCache.Unlock()
+	return nil
+}
+
+func toRule(r models.ModerationRule) moderation.Rule {
+	return moderation.Rule{ID: r.ID, Pattern: r.Pattern, Regex: r.IsRegex, Action: moderation.Action(r.Action)}
+}
+
+// Check 检查一段文本
+func (s *ModerationService) Check(text string) *moderation.Result {
+	return s.filter().Check(text)
+}
+
+// blockedError 拒绝发布的提示，带上命中的词
+func blockedError(res *moderation.Result) error {
+	return fmt.Errorf("%w「%s」，请修改后重试", ErrContentBlocked, strings.Join(res.Words(moderation.ActionBlock), "、"))
+}
+
+// ReviewProduct 发布/修改商品前检查名称和描述 (为空的字段不检查)：命中 mask 规则的部分直接打码，
+// 命中 block 规则时返回 ErrContentBlocked；返回的结果交给 FlagProduct 记录待审核
+// 结果的 Original 是打码前的名称和描述，审核时要看到卖家提交的原文
+func (s *ModerationService) ReviewProduct(p *models.Product) (*moderation.Result, error) {
+	merged := &moderation.Result{}
+	var originals []string
+	for _, field := range []*string{&p.Name, &p.Description} {
+		if *field == "" {
+			continue
+		}
+		originals = append(originals, *field)
+		res := s.Check(*field)
+		*field = res.Text
+		merged.Hits = append(merged.Hits, res.Hits...)
+		merged.Blocked = merged.Blocked || res.Blocked
+		merged.Flagged = merged.Flagged || res.Flagged
+	}
+	merged.Original = strings.Join(originals, "\n")
+	if merged.Blocked {
+		return merged, blockedError(merged)
+	}
+	return merged, nil
+}
+
+// FlagProduct 商品命中 flag 规则时加入审核队列 (商品保存之后调用)
+// 记录 ReviewProduct 检查的原文：保存的名称和描述已被 mask 规则打码
+func (s *ModerationService) FlagProduct(p *models.Product, res *moderation.Result) {
+	if res == nil || !res.Flagged {
+		return
+	}
+	s.flag(models.FlagTargetProduct, p.ID, p.UserID, res.Original, res)
+}
+
+// MessageFilter 注册到 WebSocket 的消息检查：文字消息命中 mask 规则时打码，命中 block 规则时拒绝发送
+func (s *ModerationService) MessageFilter(c *ws.Client, msg *models.Message) error {
+	if msg.Type != 1 {
+		return nil
+	}
+	res := s.Check(msg.Content)
+	if res.Blocked {
+		return ws.NewError("content_blocked", blockedError(res).Error())
+	}
+	msg.Content = res.Text
+	return nil
+}
+
+// MessageHook 注册到 WebSocket 的存库后回调：文字消息命中 flag 规则时加入审核队列
+// 检查发送者的原文：存库的内容已被 mask 规则打码，与 mask 规则重叠的 flag 规则在打码后的文字上匹配不到
+func (s *ModerationService) MessageHook(msg *models.Message) {
+	if msg.Type != 1 {
+		return
+	}
+	original := msg.OriginalContent
+	if original == "" {
+		original = msg.Content
+	}
+	if res := s.Check(original); res.Flagged {
+		s.flag(models.FlagTargetMessage, msg.ID, msg.SenderID, original, res)
+	}
+}
+
+func (s *ModerationService) flag(targetType string, targetID, userID uint, content string, res *moderation.Result) {
+	flag := models.ModerationFlag{
+		TargetType: targetType,
+		TargetID:   targetID,
+		UserID:     userID,
+		Content:    content,
+		Matched:    strings.Join(res.Words(moderation.ActionFlag), ","),
+		Status:     models.FlagPending,
+	}
+	if err := config.DB.Create(&flag).Error; err != nil {
+		log.Println("记录待审核内容失败:", err)
+	}
+}
+
+// ModerationRuleInput 新建/修改规则的参数，Enabled 为空时新建默认启用、修改时保持不变
+type ModerationRuleInput struct {
+	Pattern string `json:"pattern"`
+	IsRegex bool   `json:"is_regex"`
+	Action  string `json:"action"`
+	Enabled *bool  `json:"enabled"`
+	Note    string `json:"note"`
+}
+
+func (in ModerationRuleInput) validate() error {
+	if strings.TrimSpace(in.Pattern) == "" {
+		return errors.New("规则内容不能为空")
+	}
+	return moderation.Validate(moderation.Rule{Pattern: in.Pattern, Regex: in.IsRegex, Action: moderation.Action(in.Action)})
+}
+
+// ListRules 全部规则 (包含停用的)
+func (s *ModerationService) ListRules() ([]models.ModerationRule, error) {
+	var rules []models.ModerationRule
+	err := config.DB.Order("id desc").Find(&rules).Error
+	return rules, err
+}
+
+// CreateRule 新建规则
+func (s *ModerationService) CreateRule(input ModerationRuleInput) (*models.ModerationRule, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	rule := models.ModerationRule{
+		Pattern: input.Pattern,
+		IsRegex: input.IsRegex,
+		Action:  input.Action,
+		Enabled: true,
+		Note:    input.Note,
+	}
+	if err := config.DB.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	// enabled 列有默认值，false 需要单独写入
+	if input.Enabled != nil && !*input.Enabled {
+		rule.Enabled = false
+		config.DB.Model(&rule).Update("enabled", false)
+	}
+	s.Reload()
+	return &rule, nil
+}
+
+// UpdateRule 修改规则
+func (s *ModerationService) UpdateRule(id uint, input ModerationRuleInput) (*models.ModerationRule, error) {
+	var rule models.ModerationRule
+	if err := config.DB.First(&rule, id).Error; err != nil {
+		return nil, errors.New("规则不存在")
+	}
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"pattern":  input.Pattern,
+		"is_regex": input.IsRegex,
+		"action":   input.Action,
+		"note":     input.Note,
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+	if err := config.DB.Model(&rule).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	config.DB.First(&rule, id)
+	s.Reload()
+	return &rule, nil
+}
+
+// DeleteRule 删除规则 (已有的审核记录保留)
+func (s *ModerationService) DeleteRule(id uint) error {
+	if err := config.DB.Delete(&models.ModerationRule{}, id).Error; err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+// ListFlags 审核队列 (游标分页，status 为空时返回全部)
+func (s *ModerationService) ListFlags(cursor *utils.CursorPage, status string) ([]models.ModerationFlag, int64, string, error) {
+	var flags []models.ModerationFlag
+	var total int64
+
+	db := config.DB.Model(&models.ModerationFlag{})
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	db.Count(&total)
+
+	if err := cursor.Apply(db.Preload("User"), "", true, "id").Find(&flags).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	flags, next := utils.CursorResult(cursor, flags, func(f models.ModerationFlag) (*float64, uint) { return nil, f.ID })
+	return flags, total, next, nil
+}
+
+// ReviewFlag 处理一条审核记录：通过则保留内容；违规则下架商品 / 屏蔽消息
+func (s *ModerationService) ReviewFlag(id, reviewerID uint, status string) (*models.ModerationFlag, error) {
+	if status != models.FlagApproved && status != models.FlagRejected {
+		return nil, errors.New("审核结果只能是 approved 或 rejected")
+	}
+
+	var flag models.ModerationFlag
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&flag, id).Error; err != nil {
+			return errors.New("审核记录不存在")
+		}
+		now := time.Now()
+		if err := tx.Model(&flag).Updates(map[string]interface{}{
+			"status":      status,
+			"reviewer_id": reviewerID,
+			"reviewed_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		flag.Status, flag.ReviewerID, flag.ReviewedAt = status, reviewerID, &now
+		if status != models.FlagRejected {
+			return nil
+		}
+
+		switch flag.TargetType {
+		case models.FlagTargetProduct:
+			// 3 = 下架(违规)，与 AdminService.AuditProduct 一致
+			return tx.Model(&models.Product{}).Where("id = ?", flag.TargetID).Update("status", 3).Error
+		case models.FlagTargetMessage:
+			if err := tx.Model(&models.Message{}).Where("id = ?", flag.TargetID).
+				Update("content", models.MessageRemovedText).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Conversation{}).Where("last_message_id = ?", flag.TargetID).
+				Update("last_message", models.MessageRemovedText).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"gotest/config"
+	"gotest/internal/models"
+	"testing"
+	"time"
+)
+
+// resetModerationCache 让下次检查从测试数据库重新加载规则
+func resetModerationCache(t *testing.T) {
+	t.Helper()
+	moderationCache.Lock()
+	moderationCache.filter, moderationCache.loadedAt = nil, time.Time{}
+	moderationCache.Unlock()
+	t.Cleanup(func() {
+		moderationCache.Lock()
+		moderationCache.filter, moderationCache.loadedAt = nil, time.Time{}
+		moderationCache.Unlock()
+	})
+}
+
+func TestFlagProductKeepsOriginalText(t *testing.T) {
+	setupTestDB(t)
+	resetModerationCache(t)
+	config.DB.Create(&[]models.ModerationRule{
+		{Pattern: "微信", Action: "mask", Enabled: true},
+		{Pattern: "加微信", Action: "flag", Enabled: true},
+	})
+
+	s := new(ModerationService)
+	p := models.Product{Name: "相机 加微信", Description: "私聊加微信便宜", Price: 100, UserID: 1}
+	res, err := s.ReviewProduct(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "相机 加**" || p.Description != "私聊加**便宜" {
+		t.Fatalf("保存的内容没有打码: %q / %q", p.Name, p.Description)
+	}
+	config.DB.Omit("User").Create(&p)
+	s.FlagProduct(&p, res)
+
+	var flag models.ModerationFlag
+	if err := config.DB.Where("target_type = ? AND target_id = ?", models.FlagTargetProduct, p.ID).First(&flag).Error; err != nil {
+		t.Fatalf("商品没有进入审核队列: %v", err)
+	}
+	if flag.Content != "相机 加微信\n私聊加微信便宜" {
+		t.Fatalf("审核记录的内容为 %q, 期望打码前的原文", flag.Content)
+	}
+	if flag.Matched != "加微信" {
+		t.Fatalf("审核记录的命中词为 %q", flag.Matched)
+	}
+}
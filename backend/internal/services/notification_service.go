@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"gotest/config"
+	"gotest/internal/models"
+	"gotest/pkg/ws"
+	"log"
+	"sync"
+)
+
+// fanoutQueueSize 等待处理的群发任务上限，超出时丢弃新任务
+const fanoutQueueSize = 1024
+
+// NotificationService 站内通知：写库后通过 WebSocket 实时推送给在线用户
+// 给收藏者群发的通知交给后台 worker 依次处理，不阻塞下单、改价等请求
+type NotificationService struct {
+	Hub *ws.Hub
+
+	once sync.Once
+	jobs chan func()
+}
+
+// enqueue 把群发任务交给 worker，首次调用时启动 worker
+func (s *NotificationService) enqueue(job func()) {
+	s.once.Do(func() {
+		s.jobs = make(chan func(), fanoutQueueSize)
+		go func() {
+			for job := range s.jobs {
+				job()
+			}
+		}()
+	})
+	select {
+	case s.jobs <- job:
+	default:
+		log.Println("通知队列已满，丢弃一次群发通知")
+	}
+}
+
+// Notify 给单个用户发送通知
+func (s *NotificationService) Notify(n *models.Notification) error {
+	if err := config.DB.Create(n).Error; err != nil {
+		return err
+	}
+	if s.Hub != nil {
+		s.Hub.PushToUser(n.UserID, "notification", n)
+	}
+	return nil
+}
+
+// NotifyPriceDrop 商品降价时通知所有收藏者 (异步)
+func (s *NotificationService) NotifyPriceDrop(product models.Product, oldPrice float64) {
+	content := fmt.Sprintf("你收藏的「%s」从 ¥%.2f 降到了 ¥%.2f", product.Name, oldPrice, product.Price)
+	s.enqueue(func() {
+		s.notifyFavoriters(product.ID, 0, models.NotificationPriceDrop, "收藏商品降价啦", content)
+	})
+}
+
+// NotifyAlmostSold 商品被下单 (待支付) 时通知其他收藏者 (异步)
+func (s *NotificationService) NotifyAlmostSold(product models.Product, buyerID uint) {
+	content := fmt.Sprintf("你收藏的「%s」已被其他同学下单，即将售出", product.Name)
+	s.enqueue(func() {
+		s.notifyFavoriters(product.ID, buyerID, models.NotificationAlmostSold, "收藏商品即将售出", content)
+	})
+}
+
+// notifyFavoriters 通知收藏了该商品的用户，excludeUserID 不通知 (0 表示不排除)
+func (s *NotificationService) notifyFavoriters(productID, excludeUserID uint, typ, title, content string) {
+	var userIDs []uint
+	config.DB.Model(&models.Favorite{}).Where("product_id = ? AND user_id <> ?", productID, excludeUserID).Pluck("user_id", &userIDs)
+
+	for _, uid := range userIDs {
+		n := models.Notification{
+			UserID:    uid,
+			Type:      typ,
+			Title:     title,
+			Content:   content,
+			ProductID: productID,
+		}
+		if err := s.Notify(&n); err != nil {
+			fmt.Println("通知发送失败:", err)
+		}
+	}
+}
+
+// List 获取用户的通知 (最新在前)
+func (s *NotificationService) List(userID uint) ([]models.Notification, int64, error) {
+	var list []models.Notification
+	var unread int64
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at desc").Limit(100).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	config.DB.Model(&models.Notification{}).Where("user_id = ? AND is_read = ?", userID, false).Count(&unread)
+	return list, unread, nil
+}
+
+// MarkRead 标记通知已读，id 为 0 时全部标记
+func (s *NotificationService) MarkRead(userID, id uint) error {
+	db := config.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if id != 0 {
+		db = db.Where("id = ?", id)
+	}
+	return db.Update("is_read", true).Error
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"gotest/config"
+	"gotest/internal/models"
+	"gotest/pkg/ws"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PrivacyService 拉黑名单、消息隐私设置和用户公开信息
+type PrivacyService struct{}
+
+var (
+	ErrBlockSelf     = errors.New("不能拉黑自己")
+	ErrBlockedByPeer = errors.New("对方已拒收你的消息")
+	ErrPeerBlocked   = errors.New("你已将对方拉黑，解除后才能发送")
+	ErrPrivacyDenied = errors.New("对方只接收浏览过其商品或与其交易过的用户的消息")
+)
+
+// Block 拉黑用户 (重复拉黑不报错)
+func (s *PrivacyService) Block(blockerID, blockedID uint) error {
+	if blockerID == blockedID {
+		return ErrBlockSelf
+	}
+	var user models.User
+	if err := config.DB.Select("id").First(&user, blockedID).Error; err != nil {
+		return err
+	}
+	return config.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserBlock{BlockerID: blockerID, BlockedID: blockedID}).Error
+}
+
+// Unblock 解除拉黑
+func (s *PrivacyService) Unblock(blockerID, blockedID uint) error {
+	return config.DB.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.UserBlock{}).Error
+}
+
+// List 我拉黑的用户 (只返回公开信息)
+func (s *PrivacyService) List(blockerID uint) ([]models.UserBlock, error) {
+	var blocks []models.UserBlock
+	err := config.DB.Preload("Blocked", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "username", "nickname", "avatar")
+	}).Where("blocker_id = ?", blockerID).Order("id desc").Find(&blocks).Error
+	return blocks, err
+}
+
+// IsBlocked blockerID 是否拉黑了 blockedID
+func (s *PrivacyService) IsBlocked(blockerID, blockedID uint) bool {
+	if blockerID == 0 || blockedID == 0 {
+		return false
+	}
+	var count int64
+	config.DB.Model(&models.UserBlock{}).Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Count(&count)
+	return count > 0
+}
+
+// HideBlockerProducts 商品查询中排除拉黑了 viewerID 的卖家的商品 (未登录时不过滤)
+func (s *PrivacyService) HideBlockerProducts(db *gorm.DB, viewerID uint) *gorm.DB {
+	if viewerID == 0 {
+		return db
+	}
+	return db.Where("products.user_id NOT IN (SELECT blocker_id FROM user_blocks WHERE blocked_id = ?)", viewerID)
+}
+
+// CanMessage 检查 senderID 能否给 receiverID 发消息：任一方拉黑对方时不能；
+// 接收者设置了只接收熟人消息时，要求发送者浏览过接收者的商品、双方有过订单，或接收者曾主动给发送者发过消息
+func (s *PrivacyService) CanMessage(senderID, receiverID uint) error {
+	if senderID == receiverID {
+		return nil
+	}
+	if s.IsBlocked(receiverID, senderID) {
+		return ErrBlockedByPeer
+	}
+	if s.IsBlocked(senderID, receiverID) {
+		return ErrPeerBlocked
+	}
+
+	var receiver models.User
+	if err := config.DB.Select("id", "message_privacy").First(&receiver, receiverID).Error; err != nil {
+		return err
+	}
+	if receiver.MessagePrivacy != models.MessagePrivacyKnown {
+		return nil
+	}
+
+	var count int64
+	config.DB.Model(&models.ProductView{}).Where("user_id = ? AND seller_id = ?", senderID, receiverID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	config.DB.Model(&models.Order{}).
+		Where("(user_id = ? AND seller_id = ?) OR (user_id = ? AND seller_id = ?)", senderID, receiverID, receiverID, senderID).
+		Count(&count)
+	if count > 0 {
+		return nil
+	}
+	config.DB.Model(&models.Message{}).Where("sender_id = ? AND receiver_id = ?", receiverID, senderID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	return ErrPrivacyDenied
+}
+
+// MessageFilter 注册到 WebSocket 的消息检查，拒绝被拉黑或不满足隐私设置的消息
+func (s *PrivacyService) MessageFilter(c *ws.Client, msg *models.Message) error {
+	err := s.CanMessage(msg.SenderID, msg.ReceiverID)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrBlockedByPeer), errors.Is(err, ErrPeerBlocked):
+		return ws.NewError("blocked", err.Error())
+	case errors.Is(err, ErrPrivacyDenied):
+		return ws.NewError("privacy", err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ws.NewError("invalid_receiver", "接收者不存在")
+	}
+	return err
+}
+
+// RecordView 记录登录用户浏览了别人的商品
+func (s *PrivacyService) RecordView(userID uint, product *models.Product) {
+	if userID == 0 || product.UserID == userID {
+		return
+	}
+	config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at"}),
+	}).Create(&models.ProductView{UserID: userID, ProductID: product.ID, SellerID: product.UserID})
+}
+
+// HasContact 两人是否有过来往 (聊过天或有过订单)，有来往时可以看到对方的用户名
+func (s *PrivacyService) HasContact(a, b uint) bool {
+	if a == b {
+		return true
+	}
+	userA, userB := models.ConversationPair(a, b)
+	var count int64
+	config.DB.Model(&models.Conversation{}).Where("user_a_id = ? AND user_b_id = ?", userA, userB).Count(&count)
+	if count > 0 {
+		return true
+	}
+	config.DB.Model(&models.Order{}).
+		Where("(user_id = ? AND seller_id = ?) OR (user_id = ? AND seller_id = ?)", a, b, b, a).
+		Count(&count)
+	return count > 0
+}
+
+// SetMessagePrivacy 修改消息隐私设置
+func (s *PrivacyService) SetMessagePrivacy(userID uint, privacy string) error {
+	if privacy != models.MessagePrivacyEveryone && privacy != models.MessagePrivacyKnown {
+		return errors.New("隐私设置只能是 everyone 或 known")
+	}
+	return config.DB.Model(&models.User{}).Where("id = ?", userID).Update("message_privacy", privacy).Error
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"gotest/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ProductImageService struct{}
+
+// SetImages 用上传 ID 列表替换商品的全部图片，并把封面同步到 products.image
+// uploadIDs 的顺序即展示顺序；coverID 为 0 或不在列表中时取第一张为封面
+func (s *ProductImageService) SetImages(tx *gorm.DB, product *models.Product, userID uint, uploadIDs []uint, coverID uint) error {
+	if len(uploadIDs) > models.MaxProductImages {
+		return errors.New("最多上传 9 张图片")
+	}
+
+	// 1. 校验上传记录存在且属于当前用户
+	var uploads []models.Upload
+	if len(uploadIDs) > 0 {
+		if err := tx.Where("id IN ? AND user_id = ?", uploadIDs, userID).Find(&uploads).Error; err != nil {
+			return err
+		}
+	}
+	byID := make(map[uint]models.Upload, len(uploads))
+	for _, u := range uploads {
+		byID[u.ID] = u
+	}
+
+	seen := make(map[uint]bool)
+	images := make([]models.ProductImage, 0, len(uploadIDs))
+	for _, id := range uploadIDs {
+		u, ok := byID[id]
+		if !ok {
+			return errors.New("图片不存在或不属于当前用户")
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		images = append(images, models.ProductImage{
+			ProductID: product.ID,
+			UploadID:  u.ID,
+			URL:       u.URL,
+			SortOrder: len(images),
+			Width:     u.Width,
+			Height:    u.Height,
+			IsCover:   u.ID == coverID,
+		})
+	}
+
+	// 2. 确定封面
+	cover := -1
+	for i := range images {
+		if images[i].IsCover {
+			cover = i
+		}
+	}
+	if cover < 0 && len(images) > 0 {
+		cover = 0
+		images[0].IsCover = true
+	}
+
+	// 3. 替换图片并同步封面
+	if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductImage{}).Error; err != nil {
+		return err
+	}
+	if len(images) > 0 {
+		if err := tx.Create(&images).Error; err != nil {
+			return err
+		}
+	}
+
+	coverURL := ""
+	if cover >= 0 {
+		coverURL = images[cover].URL
+	}
+	// 不用 Model(product)：product.Images 里还是旧图片，GORM 会把它们重新写回去
+	if err := tx.Model(&models.Product{}).Where("id = ?", product.ID).UpdateColumn("image", coverURL).Error; err != nil {
+		return err
+	}
+	product.Image = coverURL
+	product.Images = images
+	return nil
+}
+
+// DeleteImages 删除商品的全部图片记录
+func (s *ProductImageService) DeleteImages(tx *gorm.DB, productID uint) error {
+	return tx.Where("product_id = ?", productID).Delete(&models.ProductImage{}).Error
+}
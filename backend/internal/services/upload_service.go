@@ -0,0 +1,232 @@
+package services
+
+import (
+	"fmt"
+	"gotest/config"
+	"gotest/internal/models"
+	"net/url"
+	"path"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type UploadService struct{}
+
+// FindOwn 查找当前用户上传过的相同内容 (公开/私有分开去重)
+func (s *UploadService) FindOwn(userID uint, hash string, private bool, purpose string) (*models.Upload, error) {
+	var upload models.Upload
+	if err := config.DB.Where("user_id = ? AND hash = ? AND private = ?", userID, hash, private).First(&upload).Error; err != nil {
+		return nil, err
+	}
+	// 重新上传视为仍在使用，避免刚好被清理
+	updates := map[string]interface{}{"unreferenced_since": nil, "updated_at": time.Now()}
+	// 之前作为聊天图片上传过的图片又被用作纠纷凭证，改为凭证，不再被清理
+	if purpose == models.UploadPurposeEvidence && upload.Purpose != purpose {
+		updates["purpose"] = purpose
+		upload.Purpose = purpose
+	}
+	config.DB.Model(&upload).Updates(updates)
+	return &upload, nil
+}
+
+// FindShared 查找其他用户上传过的相同内容，用于复用存储中的文件
+func (s *UploadService) FindShared(hash string, private bool) (*models.Upload, error) {
+	var upload models.Upload
+	if err := config.DB.Where("hash = ? AND private = ?", hash, private).Order("id asc").First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// UsedBytes 用户已使用的存储空间
+func (s *UploadService) UsedBytes(userID uint) int64 {
+	var used int64
+	config.DB.Model(&models.Upload{}).Where("user_id = ?", userID).Select("COALESCE(SUM(size), 0)").Scan(&used)
+	return used
+}
+
+// referenceKeys 统计商品图片、商品封面、用户头像、图片消息、订单快照中引用的存储 key 及次数
+// 订单快照保存的是下单时的图片，卖家之后换图或删除商品，订单里仍要能看到
+func (s *UploadService) referenceKeys() (map[string]int, error) {
+	var refs []string
+	sources := []struct {
+		query  *gorm.DB
+		column string
+	}{
+		{config.DB.Model(&models.ProductImage{}), "url"},
+		{config.DB.Model(&models.Product{}).Where("image != ''"), "image"},
+		{config.DB.Model(&models.User{}).Where("avatar != ''"), "avatar"},
+		{config.DB.Model(&models.Message{}).Where("type = ?", 2), "content"},
+		{config.DB.Model(&models.Order{}).Where("snapshot_image != ''"), "snapshot_image"},
+		{config.DB.Model(&models.OrderItem{}).Where("snapshot_image != ''"), "snapshot_image"},
+	}
+	for _, src := range sources {
+		var values []string
+		if err := src.query.Pluck(src.column, &values).Error; err != nil {
+			return nil, err
+		}
+		refs = append(refs, values...)
+	}
+
+	counts := make(map[string]int)
+	for _, ref := range refs {
+		if key := keyFromURL(ref); key != "" {
+			counts[key]++
+		}
+	}
+	return counts, nil
+}
+
+// keyFromURL 从文件地址中取出存储 key (文件名)，兼容绝对地址、/uploads/ 相对路径和 /private/ 引用
+func keyFromURL(ref string) string {
+	if u, err := url.Parse(ref); err == nil {
+		ref = u.Path
+	}
+	key := path.Base(ref)
+	if key == "." || key == "/" {
+		return ""
+	}
+	return key
+}
+
+// Recount 重新统计每个上传文件的引用次数，并维护 unreferenced_since
+func (s *UploadService) Recount() error {
+	counts, err := s.referenceKeys()
+	if err != nil {
+		return err
+	}
+
+	var uploads []models.Upload
+	if err := config.DB.Select("id", "storage_key", "ref_count", "unreferenced_since").Find(&uploads).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, u := range uploads {
+		n := counts[u.StorageKey]
+		switch {
+		case n > 0 && (u.RefCount != n || u.UnreferencedSince != nil):
+			config.DB.Model(&models.Upload{}).Where("id = ?", u.ID).
+				Updates(map[string]interface{}{"ref_count": n, "unreferenced_since": nil})
+		case n == 0 && u.UnreferencedSince == nil:
+			config.DB.Model(&models.Upload{}).Where("id = ?", u.ID).
+				Updates(map[string]interface{}{"ref_count": 0, "unreferenced_since": now})
+		}
+	}
+	return nil
+}
+
+// CleanupOrphans 删除超过保留期仍未被引用的上传记录；
+// 存储中的文件只有在没有其他记录共享时才删除
+// 纠纷凭证没有数据表引用，引用数始终为 0，不清理
+func (s *UploadService) CleanupOrphans(grace time.Duration) (int, error) {
+	if err := s.Recount(); err != nil {
+		return 0, err
+	}
+
+	var orphans []models.Upload
+	if err := config.DB.Where("ref_count = 0 AND unreferenced_since IS NOT NULL AND unreferenced_since < ?", time.Now().Add(-grace)).
+		Where("purpose IS NULL OR purpose <> ?", models.UploadPurposeEvidence).
+		Find(&orphans).Error; err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, u := range orphans {
+		if err := config.DB.Delete(&models.Upload{}, u.ID).Error; err != nil {
+			continue
+		}
+		removed++
+
+		var shared int64
+		config.DB.Model(&models.Upload{}).Where("storage_key = ? AND private = ?", u.StorageKey, u.Private).Count(&shared)
+		if shared > 0 {
+			continue
+		}
+		keys := map[string]bool{u.StorageKey: true}
+		for _, t := range u.Thumbs() {
+			keys[t.Key] = true
+		}
+		for key := range keys {
+			if err := config.StorageFor(u.Private).Delete(key); err != nil {
+				fmt.Println("⚠️ 删除文件失败:", key, err)
+			}
+		}
+	}
+	return removed, nil
+}
+
+// StartCleanup 启动孤儿文件定期清理任务
+func (s *UploadService) StartCleanup(interval, grace time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := s.CleanupOrphans(grace)
+			if err != nil {
+				fmt.Println("⚠️ 孤儿文件清理失败:", err)
+				continue
+			}
+			if n > 0 {
+				fmt.Printf("✅ 已清理 %d 个未被引用的上传文件\n", n)
+			}
+		}
+	}()
+}
+
+// UserStorage 单个用户的存储占用
+type UserStorage struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// StorageUsage 存储使用概况
+type StorageUsage struct {
+	TotalFiles    int64         `json:"total_files"`
+	TotalBytes    int64         `json:"total_bytes"`
+	StoredBytes   int64         `json:"stored_bytes"` // 去重后实际占用
+	OrphanFiles   int64         `json:"orphan_files"` // 当前未被引用的文件
+	OrphanBytes   int64         `json:"orphan_bytes"`
+	UserQuota     int64         `json:"user_quota"`
+	TopUsers      []UserStorage `json:"top_users"`
+	ByMimeType    []MimeStorage `json:"by_mime_type"`
+	LastRecountAt time.Time     `json:"last_recount_at"`
+}
+
+// MimeStorage 按文件类型统计的存储占用
+type MimeStorage struct {
+	MimeType string `json:"mime_type"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Usage 管理后台的存储使用统计 (统计前先重新计算引用数)
+func (s *UploadService) Usage() (*StorageUsage, error) {
+	if err := s.Recount(); err != nil {
+		return nil, err
+	}
+
+	usage := &StorageUsage{UserQuota: config.Upload.UserQuota, LastRecountAt: time.Now()}
+	config.DB.Model(&models.Upload{}).Count(&usage.TotalFiles)
+	config.DB.Model(&models.Upload{}).Select("COALESCE(SUM(size), 0)").Scan(&usage.TotalBytes)
+	config.DB.Raw("SELECT COALESCE(SUM(size), 0) FROM (SELECT MAX(size) AS size FROM uploads GROUP BY storage_key, private)").Scan(&usage.StoredBytes)
+	config.DB.Model(&models.Upload{}).Where("ref_count = 0").Count(&usage.OrphanFiles)
+	config.DB.Model(&models.Upload{}).Where("ref_count = 0").Select("COALESCE(SUM(size), 0)").Scan(&usage.OrphanBytes)
+
+	if err := config.DB.Table("uploads").
+		Select("uploads.user_id, users.username, COUNT(*) AS files, SUM(uploads.size) AS bytes").
+		Joins("LEFT JOIN users ON users.id = uploads.user_id").
+		Group("uploads.user_id, users.username").Order("bytes desc").Limit(20).
+		Scan(&usage.TopUsers).Error; err != nil {
+		return nil, err
+	}
+
+	if err := config.DB.Table("uploads").Select("mime_type, COUNT(*) AS files, SUM(size) AS bytes").
+		Group("mime_type").Order("bytes desc").Scan(&usage.ByMimeType).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
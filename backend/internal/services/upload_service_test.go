@@ -0,0 +1,163 @@
+package services
+
+import (
+	"gotest/config"
+	"gotest/internal/models"
+	"gotest/pkg/storage"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 使用内存数据库和临时目录作为存储
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接各自一份，只保留一个连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Product{}, &models.ProductImage{}, &models.Upload{},
+		&models.Message{}, &models.Order{}, &models.OrderItem{}, &models.ModerationRule{}, &models.ModerationFlag{}); err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := storage.NewLocal(t.TempDir(), "/uploads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := storage.NewLocal(t.TempDir(), config.PrivatePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldDB, oldStorage, oldPrivate := config.DB, config.Storage, config.PrivateStorage
+	config.DB, config.Storage, config.PrivateStorage = db, public, private
+	t.Cleanup(func() {
+		sqlDB.Close()
+		config.DB, config.Storage, config.PrivateStorage = oldDB, oldStorage, oldPrivate
+	})
+}
+
+// createUpload 写入存储并记录上传 (聊天图片和纠纷凭证保存到私有存储)
+func createUpload(t *testing.T, userID uint, key, purpose string) models.Upload {
+	t.Helper()
+	private := purpose == models.UploadPurposeChat || purpose == models.UploadPurposeEvidence
+	if err := config.StorageFor(private).Put(key, []byte(key), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	u := models.Upload{UserID: userID, URL: config.UploadRef(key, private), StorageKey: key, Hash: key, Private: private, Purpose: purpose}
+	if err := config.DB.Create(&u).Error; err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func uploadExists(t *testing.T, key string, private bool) bool {
+	t.Helper()
+	var n int64
+	config.DB.Model(&models.Upload{}).Where("storage_key = ? AND private = ?", key, private).Count(&n)
+	rc, _, err := config.StorageFor(private).Get(key)
+	if err == nil {
+		rc.Close()
+	}
+	if (n > 0) != (err == nil) {
+		t.Fatalf("%s: 上传记录 (%d) 与存储中的文件 (%v) 不一致", key, n, err)
+	}
+	return n > 0
+}
+
+func TestCleanupKeepsOrderSnapshotImages(t *testing.T) {
+	setupTestDB(t)
+	seller := models.User{Username: "seller"}
+	buyer := models.User{Username: "buyer"}
+	config.DB.Create(&seller)
+	config.DB.Create(&buyer)
+
+	oldCover := createUpload(t, seller.ID, "old_cover.jpg", models.UploadPurposeProduct)
+	oldItem := createUpload(t, seller.ID, "old_item.jpg", models.UploadPurposeProduct)
+	newCover := createUpload(t, seller.ID, "new_cover.jpg", models.UploadPurposeProduct)
+	newItem := createUpload(t, seller.ID, "new_item.jpg", models.UploadPurposeProduct)
+	createUpload(t, seller.ID, "unused.jpg", models.UploadPurposeProduct)
+
+	images := new(ProductImageService)
+	first := models.Product{Name: "相机", Price: 100, UserID: seller.ID, User: seller}
+	second := models.Product{Name: "镜头", Price: 50, UserID: seller.ID, User: seller}
+	config.DB.Omit("User").Create(&first)
+	config.DB.Omit("User").Create(&second)
+	if err := images.SetImages(config.DB, &first, seller.ID, []uint{oldCover.ID}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := images.SetImages(config.DB, &second, seller.ID, []uint{oldItem.ID}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一卖家两件商品合并下单：订单快照为第一件，明细各一条
+	order := models.Order{
+		OrderNo:   "TEST001",
+		UserID:    buyer.ID,
+		SellerID:  seller.ID,
+		ProductID: first.ID,
+		Price:     first.Price + second.Price,
+		Snapshot:  models.NewOrderSnapshot(first),
+		Items:     []models.OrderItem{models.NewOrderItem(first), models.NewOrderItem(second)},
+	}
+	if err := config.DB.Omit("Product", "User", "Seller").Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 卖家下单后换图，旧图片只剩订单快照在引用
+	if err := images.SetImages(config.DB, &first, seller.ID, []uint{newCover.ID}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := images.SetImages(config.DB, &second, seller.ID, []uint{newItem.ID}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 保留期为负：本次统计为未引用的记录立即清理
+	removed, err := new(UploadService).CleanupOrphans(-time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || uploadExists(t, "unused.jpg", false) {
+		t.Fatalf("清理了 %d 个文件，期望只清理未被引用的 unused.jpg", removed)
+	}
+	for _, key := range []string{"old_cover.jpg", "old_item.jpg", "new_cover.jpg", "new_item.jpg"} {
+		if !uploadExists(t, key, false) {
+			t.Fatalf("%s 仍被引用，却被清理了", key)
+		}
+	}
+}
+
+func TestCleanupKeepsEvidence(t *testing.T) {
+	setupTestDB(t)
+	user := models.User{Username: "buyer"}
+	config.DB.Create(&user)
+
+	createUpload(t, user.ID, "evidence.jpg", models.UploadPurposeEvidence)
+	createUpload(t, user.ID, "unsent_chat.jpg", models.UploadPurposeChat)
+
+	// 聊天图片又被用作凭证上传时改为凭证
+	reused := createUpload(t, user.ID, "reused.jpg", models.UploadPurposeChat)
+	if _, err := new(UploadService).FindOwn(user.ID, reused.Hash, true, models.UploadPurposeEvidence); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := new(UploadService).CleanupOrphans(-time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || uploadExists(t, "unsent_chat.jpg", true) {
+		t.Fatalf("清理了 %d 个文件，期望只清理没有发出的聊天图片", removed)
+	}
+	for _, key := range []string{"evidence.jpg", "reused.jpg"} {
+		if !uploadExists(t, key, true) {
+			t.Fatalf("纠纷凭证 %s 被清理了", key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// cursorKey 游标内容：排序字段的值 + 主键 ID (ID 兜底保证顺序稳定、不重复)
+type cursorKey struct {
+	Value *float64 `json:"v,omitempty"`
+	ID    uint     `json:"id"`
+}
+
+// CursorPage 游标分页参数，所有列表接口统一使用 cursor / limit / next_cursor
+type CursorPage struct {
+	Limit int
+	after *cursorKey
+}
+
+// ParseCursorPage 解析请求中的 cursor 和 limit 参数
+func ParseCursorPage(c *gin.Context, defaultLimit, maxLimit int) (*CursorPage, error) {
+	p := &CursorPage{Limit: defaultLimit}
+
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, errors.New("limit 参数错误")
+		}
+		if n > maxLimit {
+			n = maxLimit
+		}
+		p.Limit = n
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.New("cursor 参数无效")
+		}
+		var key cursorKey
+		if err := json.Unmarshal(raw, &key); err != nil || key.ID == 0 {
+			return nil, errors.New("cursor 参数无效")
+		}
+		p.after = &key
+	}
+
+	return p, nil
+}
+
+// HasCursor 是否带了游标 (即不是第一页)
+func (p *CursorPage) HasCursor() bool {
+	return p.after != nil
+}
+
+// Apply 按 (sortExpr, idColumn) 排序并定位到游标之后，多取一条用于判断是否还有下一页
+// sortExpr 为空时只按 idColumn 排序；desc 同时决定排序字段和 ID 的方向
+func (p *CursorPage) Apply(db *gorm.DB, sortExpr string, desc bool, idColumn string) *gorm.DB {
+	dir, cmp := "asc", ">"
+	if desc {
+		dir, cmp = "desc", "<"
+	}
+
+	if p.after != nil {
+		if sortExpr != "" && p.after.Value != nil {
+			v := *p.after.Value
+			db = db.Where("("+sortExpr+" "+cmp+" ? OR ("+sortExpr+" = ? AND "+idColumn+" "+cmp+" ?))", v, v, p.after.ID)
+		} else {
+			db = db.Where(idColumn+" "+cmp+" ?", p.after.ID)
+		}
+	}
+
+	if sortExpr != "" {
+		db = db.Order(sortExpr + " " + dir)
+	}
+	return db.Order(idColumn + " " + dir).Limit(p.Limit + 1)
+}
+
+// Skip 内存分页时判断某条记录是否在游标之前 (应跳过)，只比较 ID
+func (p *CursorPage) Skip(id uint, desc bool) bool {
+	if p.after == nil {
+		return false
+	}
+	if desc {
+		return id >= p.after.ID
+	}
+	return id <= p.after.ID
+}
+
+// CursorResult 截掉多取的一条并生成 next_cursor (没有下一页时为空字符串)
+// key 返回每条记录的排序值和 ID，只按 ID 排序时排序值返回 nil
+func CursorResult[T any](p *CursorPage, rows []T, key func(T) (*float64, uint)) ([]T, string) {
+	if len(rows) <= p.Limit {
+		return rows, ""
+	}
+	rows = rows[:p.Limit]
+	value, id := key(rows[len(rows)-1])
+	raw, _ := json.Marshal(cursorKey{Value: value, ID: id})
+	return rows, base64.RawURLEncoding.EncodeToString(raw)
+}
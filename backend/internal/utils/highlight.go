@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// 高亮标签
+const (
+	HighlightOpen  = "<em>"
+	HighlightClose = "</em>"
+)
+
+// Highlight 用 <em></em> 包裹 text 中出现的所有关键词 (英文不区分大小写)
+// 返回 HTML 片段：原文按 HTML 转义，只有高亮标签是标记，前端可以直接 v-html
+func Highlight(text string, terms []string) string {
+	var b strings.Builder
+	last := 0
+	for _, sp := range matchSpans(text, terms) {
+		b.WriteString(html.EscapeString(text[last:sp[0]]))
+		b.WriteString(HighlightOpen)
+		b.WriteString(html.EscapeString(text[sp[0]:sp[1]]))
+		b.WriteString(HighlightClose)
+		last = sp[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// Snippet 截取第一个关键词附近 radius 个字符的片段并高亮，没有命中时返回开头部分
+// 与 Highlight 一样返回转义后的 HTML 片段
+func Snippet(text string, terms []string, radius int) string {
+	spans := matchSpans(text, terms)
+	start, end := 0, len(text)
+	if len(spans) > 0 {
+		start = backRunes(text, spans[0][0], radius)
+		end = forwardRunes(text, spans[0][1], radius)
+	} else {
+		end = forwardRunes(text, 0, radius*2)
+	}
+
+	s := Highlight(text[start:end], terms)
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+// matchSpans 找出所有关键词命中的字节区间 (按位置排序，重叠部分合并)
+func matchSpans(text string, terms []string) [][2]int {
+	lower := strings.ToLower(text)
+	// ToLower 可能改变字节长度，此时放弃大小写无关匹配，保证区间正确
+	if len(lower) != len(text) {
+		lower = text
+	}
+
+	marks := make([]bool, len(text))
+	for _, term := range terms {
+		t := strings.ToLower(term)
+		if t == "" {
+			continue
+		}
+		for from := 0; ; {
+			i := strings.Index(lower[from:], t)
+			if i < 0 {
+				break
+			}
+			for k := from + i; k < from+i+len(t); k++ {
+				marks[k] = true
+			}
+			from += i + len(t)
+		}
+	}
+
+	var spans [][2]int
+	for i := 0; i < len(marks); i++ {
+		if !marks[i] {
+			continue
+		}
+		j := i
+		for j < len(marks) && marks[j] {
+			j++
+		}
+		spans = append(spans, [2]int{i, j})
+		i = j
+	}
+	return spans
+}
+
+func backRunes(s string, pos, n int) int {
+	for ; n > 0 && pos > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:pos])
+		pos -= size
+	}
+	return pos
+}
+
+func forwardRunes(s string, pos, n int) int {
+	for ; n > 0 && pos < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[pos:])
+		pos += size
+	}
+	return pos
+}
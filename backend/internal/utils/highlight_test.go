@@ -0,0 +1,52 @@
+package utils
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	cases := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"无命中", "二手自行车", []string{"键盘"}, "二手自行车"},
+		{"中文", "二手自行车出售", []string{"自行车"}, "二手<em>自行车</em>出售"},
+		{"英文不区分大小写", "Apple iPhone", []string{"iphone"}, "Apple <em>iPhone</em>"},
+		{"多个关键词", "cat and dog", []string{"dog", "cat"}, "<em>cat</em> and <em>dog</em>"},
+		{"重叠命中合并", "abcd", []string{"abc", "bcd"}, "<em>abcd</em>"},
+		{"转义无命中的原文", `<img src=x onerror="alert(1)">`, nil, `&lt;img src=x onerror=&#34;alert(1)&#34;&gt;`},
+		{"转义命中与未命中部分", "<b>键盘</b>&", []string{"键盘"}, "&lt;b&gt;<em>键盘</em>&lt;/b&gt;&amp;"},
+		{"关键词本身含标签", "a<script>b", []string{"<script>"}, "a<em>&lt;script&gt;</em>b"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Highlight(c.text, c.terms); got != c.want {
+				t.Fatalf("Highlight(%q, %q) = %q, 期望 %q", c.text, c.terms, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	cases := []struct {
+		name   string
+		text   string
+		terms  []string
+		radius int
+		want   string
+	}{
+		{"短文本不截断", "九成新键盘", []string{"键盘"}, 5, "九成新<em>键盘</em>"},
+		{"按字符而不是字节截取", "一二三四五键盘六七八九十", []string{"键盘"}, 2, "…四五<em>键盘</em>六七…"},
+		{"emoji 不被截断", "😀😀😀键盘😀😀😀", []string{"键盘"}, 1, "…😀<em>键盘</em>😀…"},
+		{"无命中取开头", "一二三四五六七八", []string{"键盘"}, 2, "一二三四…"},
+		{"英文不区分大小写", "xxxx MacBook Pro yyyy", []string{"macbook"}, 2, "…x <em>MacBook</em> P…"},
+		{"片段转义", "<<<<键盘>>>>", []string{"键盘"}, 1, "…&lt;<em>键盘</em>&gt;…"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Snippet(c.text, c.terms, c.radius); got != c.want {
+				t.Fatalf("Snippet(%q, %q, %d) = %q, 期望 %q", c.text, c.terms, c.radius, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/webp"
+)
+
+// 支持的图片格式
+const (
+	ImageJPEG = "jpeg"
+	ImagePNG  = "png"
+	ImageGIF  = "gif"
+	ImageWebP = "webp"
+)
+
+// ErrNotImage 文件内容不是支持的图片格式
+var ErrNotImage = errors.New("仅支持 JPEG / PNG / WebP / GIF 图片")
+
+// ErrImageTooLarge 图片分辨率超出限制
+var ErrImageTooLarge = errors.New("图片分辨率过大")
+
+// ImageLimits 解码前按文件头校验的尺寸上限，防止很小的文件解码出巨大的位图 (解压炸弹)
+type ImageLimits struct {
+	MaxSide      int // 宽、高上限
+	MaxPixels    int // 宽 × 高上限
+	MaxGIFPixels int // GIF 帧数 × 画布面积上限
+}
+
+// check 校验宽高和像素总数
+func (l ImageLimits) check(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return ErrNotImage
+	}
+	if width > l.MaxSide || height > l.MaxSide || width*height > l.MaxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// ProcessedImage 清理过元数据的图片
+type ProcessedImage struct {
+	Format string      // jpeg / png / gif / webp
+	Data   []byte      // 重新编码后的文件内容 (不含 EXIF/GPS 等元数据)
+	Width  int         // 宽 (已按 EXIF 方向旋转)
+	Height int         // 高
+	Image  image.Image // 解码后的图片，用于生成缩略图；动画 WebP 无法解码时为 nil
+}
+
+// SniffImage 根据文件头判断真实的图片格式，不信任客户端传来的扩展名
+func SniffImage(data []byte) (string, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ImageJPEG, nil
+	case "image/png":
+		return ImagePNG, nil
+	case "image/gif":
+		return ImageGIF, nil
+	case "image/webp":
+		return ImageWebP, nil
+	}
+	return "", ErrNotImage
+}
+
+// MimeType 图片格式对应的 MIME 类型
+func MimeType(format string) string {
+	return "image/" + format
+}
+
+// ProcessImage 校验并清理图片：
+// JPEG / PNG 解码后重新编码 (丢弃 EXIF、GPS、文本块等全部元数据)，JPEG 先按 EXIF 方向摆正；
+// GIF 逐帧重新编码 (丢弃注释和扩展块)；
+// WebP 不重新编码 (没有可用的编码器)，直接移除 RIFF 中的 EXIF / XMP 块，再解码一份用于生成缩略图
+// 解码前先读文件头中的尺寸，超出 limits 的直接拒绝
+func ProcessImage(data []byte, limits ImageLimits) (*ProcessedImage, error) {
+	format, err := SniffImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if format != ImageWebP {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrNotImage
+		}
+		if err := limits.check(cfg.Width, cfg.Height); err != nil {
+			return nil, err
+		}
+		if format == ImageGIF {
+			frames, err := gifFrameCount(data)
+			if err != nil {
+				return nil, err
+			}
+			if frames*cfg.Width*cfg.Height > limits.MaxGIFPixels {
+				return nil, ErrImageTooLarge
+			}
+		}
+	}
+
+	out := &ProcessedImage{Format: format}
+	var buf bytes.Buffer
+
+	switch format {
+	case ImageJPEG:
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrNotImage
+		}
+		img = applyOrientation(toRGBA(img), jpegOrientation(data))
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		out.Image = img
+	case ImagePNG:
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrNotImage
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		out.Image = img
+	case ImageGIF:
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(g.Image) == 0 {
+			return nil, ErrNotImage
+		}
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return nil, err
+		}
+		out.Image = g.Image[0]
+	case ImageWebP:
+		clean, w, h, err := stripWebP(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := limits.check(w, h); err != nil {
+			return nil, err
+		}
+		buf.Write(clean)
+		out.Width, out.Height = w, h
+		// 动画 WebP 解码器不支持，仍然接受上传，只是不生成缩略图
+		if img, err := webp.Decode(bytes.NewReader(clean)); err == nil {
+			out.Image = img
+		}
+	}
+
+	out.Data = buf.Bytes()
+	if out.Image != nil {
+		b := out.Image.Bounds()
+		out.Width, out.Height = b.Dx(), b.Dy()
+	}
+	return out, nil
+}
+
+// EncodeThumbnail 把图片缩放到长边不超过 maxSide (不放大)
+// JPEG 源输出 JPEG，其余输出 PNG 以保留透明度；返回内容和扩展名
+func EncodeThumbnail(img image.Image, format string, maxSide int) ([]byte, string, error) {
+	thumb := Resize(img, maxSide)
+	var buf bytes.Buffer
+	if format == ImageJPEG {
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".jpg", nil
+	}
+	if err := png.Encode(&buf, thumb); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+// Resize 按区域平均缩小图片，使长边不超过 maxSide；本来就更小的图片原样返回
+func Resize(img image.Image, maxSide int) image.Image {
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= maxSide && sh <= maxSide {
+		return src
+	}
+
+	dw, dh := maxSide, sh*maxSide/sw
+	if sh > sw {
+		dw, dh = sw*maxSide/sh, maxSide
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// toRGBA 转成原点为 (0,0) 的 RGBA，方便直接按像素下标读写
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// jpegOrientation 读取 JPEG 中 EXIF 的 Orientation 标签 (0x0112)，没有时返回 1
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// SOS 之后是图像数据，不会再有 EXIF
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation 在 EXIF 的 TIFF 结构中查找 IFD0 的 Orientation
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < count; k++ {
+		entry := ifd + 2 + k*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			v := int(order.Uint16(tiff[entry+8:]))
+			if v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation 按 EXIF 方向值 (1-8) 旋转/翻转图片，使其正向显示
+func applyOrientation(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿左上-右下对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针 90°
+				dx, dy = h-1-y, x
+			case 7: // 沿右上-左下对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针 90°
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// stripWebP 移除 WebP 中的 EXIF / XMP 块，并从图像头中读出宽高
+func stripWebP(data []byte) ([]byte, int, int, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, 0, 0, ErrNotImage
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:12])
+	width, height := 0, 0
+	vp8x := -1
+	hasImage := false // VP8X 只是扩展头，必须还有图像数据块 (静态 VP8 / VP8L 或动画帧 ANMF)
+
+	for i := 12; i+8 <= len(data); {
+		id := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size
+		if size < 0 || end > len(data) {
+			return nil, 0, 0, ErrNotImage
+		}
+		body := data[i+8 : end]
+		if size%2 == 1 && end < len(data) {
+			end++ // 奇数长度的块有 1 字节填充
+		}
+
+		switch id {
+		case "EXIF", "XMP ":
+			i = end
+			continue
+		case "VP8X":
+			// 长度不足的 VP8X 块不合法，也不记录位置 (后面要改写其中的标志位)
+			if len(body) >= 10 {
+				width = (int(body[4]) | int(body[5])<<8 | int(body[6])<<16) + 1
+				height = (int(body[7]) | int(body[8])<<8 | int(body[9])<<16) + 1
+				vp8x = out.Len()
+			}
+		case "ANMF":
+			hasImage = true
+		case "VP8 ":
+			hasImage = true
+			if width == 0 && len(body) >= 10 {
+				width = int(binary.LittleEndian.Uint16(body[6:]) & 0x3FFF)
+				height = int(binary.LittleEndian.Uint16(body[8:]) & 0x3FFF)
+			}
+		case "VP8L":
+			hasImage = true
+			if width == 0 && len(body) >= 5 {
+				bits := binary.LittleEndian.Uint32(body[1:])
+				width = int(bits&0x3FFF) + 1
+				height = int((bits>>14)&0x3FFF) + 1
+			}
+		}
+		out.Write(data[i:end])
+		i = end
+	}
+
+	clean := out.Bytes()
+	// 清除 VP8X 中的 EXIF(0x08) / XMP(0x04) 标志位
+	if vp8x >= 0 {
+		clean[vp8x+8] &^= 0x08 | 0x04
+	}
+	binary.LittleEndian.PutUint32(clean[4:], uint32(len(clean)-8))
+	if !hasImage || width == 0 || height == 0 {
+		return nil, 0, 0, ErrNotImage
+	}
+	return clean, width, height, nil
+}
+
+// gifFrameCount 只遍历 GIF 的块结构统计帧数，不解码图像数据
+func gifFrameCount(data []byte) (int, error) {
+	if len(data) < 13 {
+		return 0, ErrNotImage
+	}
+	i := 13
+	// 全局颜色表
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipSubBlocks 跳过以 0 长度结尾的数据子块
+	skipSubBlocks := func() bool {
+		for i < len(data) {
+			n := int(data[i])
+			i++
+			if n == 0 {
+				return true
+			}
+			i += n
+		}
+		return false
+	}
+
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // 扩展块：标签 + 子块
+			i += 2
+			if !skipSubBlocks() {
+				return 0, ErrNotImage
+			}
+		case 0x2C: // 图像描述符 (10 字节) + 局部颜色表 + LZW 最小码长 + 子块
+			if i+10 > len(data) {
+				return 0, ErrNotImage
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++
+			if !skipSubBlocks() {
+				return 0, ErrNotImage
+			}
+			frames++
+		case 0x3B: // 结束符
+			return frames, nil
+		default:
+			return 0, ErrNotImage
+		}
+	}
+	// 缺少结束符的 GIF 标准库也能解码，按已统计的帧数算
+	return frames, nil
+}
@@ -0,0 +1,344 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var testLimits = ImageLimits{MaxSide: 4096, MaxPixels: 1 << 24, MaxGIFPixels: 1 << 26}
+
+// 左半红、右半蓝的图片，用来判断旋转方向
+func twoColorImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+// exifJPEG 编码 JPEG 并在 SOI 之后插入带 Orientation 和附加文本的 EXIF (APP1) 段
+func exifJPEG(t *testing.T, img image.Image, orientation int, extra string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// TIFF 头 (小端) + IFD0: 1 个条目 (Orientation, SHORT, 1)，之后是附加文本 (模拟 GPS 等信息)
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, uint16(orientation))
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // 值补齐 4 字节 + 下一个 IFD 偏移 0
+	tiff = append(tiff, extra...)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(seg)+2))
+	app1 = append(app1, seg...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+// textPNG 编码 PNG 并在 IEND 之前插入 tEXt 块
+func textPNG(t *testing.T, img image.Image, text string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	body := append([]byte("tEXt"), "Comment\x00"+text...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+
+	iend := len(data) - 12
+	out := append([]byte{}, data[:iend]...)
+	out = append(out, chunk...)
+	return append(out, data[iend:]...)
+}
+
+// commentGIF 编码多帧 GIF 并在结束符之前插入注释扩展块
+func commentGIF(t *testing.T, frames int, text string) []byte {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.Black, color.White})
+		frame.SetColorIndex(i%8, i%8, 1)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	comment := []byte{0x21, 0xFE, byte(len(text))}
+	comment = append(comment, text...)
+	comment = append(comment, 0)
+
+	out := append([]byte{}, data[:len(data)-1]...)
+	out = append(out, comment...)
+	return append(out, 0x3B)
+}
+
+// 1x1 的无损 WebP (所有前缀码都只有一个符号，像素数据不占位)，改写宽高即可得到任意尺寸的纯色图片
+const tinyVP8L = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+// webpChunk 编码一个 RIFF 块 (奇数长度补 1 字节)
+func webpChunk(id string, body []byte) []byte {
+	chunk := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	chunk = append(chunk, body...)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpFile 组装 WebP 文件，修正 RIFF 长度
+func webpFile(chunks ...[]byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+// vp8lChunk 宽 w、高 h 的纯色无损图像块
+func vp8lChunk(t *testing.T, w, h int) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(tinyVP8L)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := append([]byte{}, data[20:]...)
+	binary.LittleEndian.PutUint32(body[1:], uint32(w-1)|uint32(h-1)<<14|1<<28)
+	return webpChunk("VP8L", body)
+}
+
+// vp8xChunk 扩展头：flags + 3 字节保留 + 宽高 (各 3 字节，减 1)
+func vp8xChunk(flags byte, w, h int) []byte {
+	body := []byte{flags, 0, 0, 0,
+		byte(w - 1), byte((w - 1) >> 8), byte((w - 1) >> 16),
+		byte(h - 1), byte((h - 1) >> 8), byte((h - 1) >> 16)}
+	return webpChunk("VP8X", body)
+}
+
+// metadataWebP 带 EXIF 和 XMP 块的扩展格式 WebP
+func metadataWebP(t *testing.T, w, h int, text string) []byte {
+	return webpFile(
+		vp8xChunk(0x10|0x08|0x04, w, h),
+		vp8lChunk(t, w, h),
+		webpChunk("EXIF", []byte("II*\x00"+text)),
+		webpChunk("XMP ", []byte("<x:xmpmeta>"+text+"</x:xmpmeta>")),
+	)
+}
+
+func TestProcessImageJPEGOrientation(t *testing.T) {
+	const w, h = 32, 16
+	red, blue := image.Pt(4, 8), image.Pt(28, 8) // 原图中红、蓝两块区域内的点
+
+	cases := []struct {
+		orientation int
+		width       int
+		height      int
+		move        func(p image.Point) image.Point // 原图坐标 -> 摆正后的坐标
+	}{
+		{1, w, h, func(p image.Point) image.Point { return p }},
+		{3, w, h, func(p image.Point) image.Point { return image.Pt(w-1-p.X, h-1-p.Y) }},
+		{6, h, w, func(p image.Point) image.Point { return image.Pt(h-1-p.Y, p.X) }},
+		{8, h, w, func(p image.Point) image.Point { return image.Pt(p.Y, w-1-p.X) }},
+		{9, w, h, func(p image.Point) image.Point { return p }}, // 非法方向值按 1 处理
+	}
+	for _, c := range cases {
+		out, err := ProcessImage(exifJPEG(t, twoColorImage(w, h), c.orientation, ""), testLimits)
+		if err != nil {
+			t.Fatalf("方向 %d: %v", c.orientation, err)
+		}
+		if out.Width != c.width || out.Height != c.height {
+			t.Fatalf("方向 %d: 尺寸 %dx%d，期望 %dx%d", c.orientation, out.Width, out.Height, c.width, c.height)
+		}
+		decoded, err := jpeg.Decode(bytes.NewReader(out.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, p := range map[string]image.Point{"红": red, "蓝": blue} {
+			r, _, b, _ := decoded.At(c.move(p).X, c.move(p).Y).RGBA()
+			if (name == "红") != (r > b) {
+				t.Fatalf("方向 %d: %s色区域没有旋转到正确位置", c.orientation, name)
+			}
+		}
+	}
+}
+
+func TestProcessImageStripsMetadata(t *testing.T) {
+	const secret = "GPS-SECRET-31.2304N"
+	cases := []struct {
+		name   string
+		data   []byte
+		format string
+	}{
+		{"JPEG EXIF", exifJPEG(t, twoColorImage(16, 16), 1, secret), ImageJPEG},
+		{"PNG tEXt", textPNG(t, twoColorImage(16, 16), secret), ImagePNG},
+		{"GIF 注释", commentGIF(t, 2, secret), ImageGIF},
+		{"WebP EXIF/XMP", metadataWebP(t, 16, 16, secret), ImageWebP},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if !bytes.Contains(c.data, []byte(secret)) {
+				t.Fatal("测试数据中没有元数据")
+			}
+			out, err := ProcessImage(c.data, testLimits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Format != c.format {
+				t.Fatalf("格式 %s，期望 %s", out.Format, c.format)
+			}
+			if bytes.Contains(out.Data, []byte(secret)) {
+				t.Fatal("处理后仍包含元数据")
+			}
+			if _, err := SniffImage(out.Data); err != nil {
+				t.Fatal("处理后不再是有效图片")
+			}
+		})
+	}
+}
+
+func TestStripWebPClearsFlagsAndKeepsImage(t *testing.T) {
+	clean, w, h, err := stripWebP(metadataWebP(t, 40, 20, "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 40 || h != 20 {
+		t.Fatalf("尺寸 %dx%d，期望 40x20", w, h)
+	}
+	if flags := clean[20]; flags&(0x08|0x04) != 0 || flags&0x10 == 0 {
+		t.Fatalf("VP8X 标志位 %#x：应清除 EXIF/XMP、保留 alpha", flags)
+	}
+	if size := binary.LittleEndian.Uint32(clean[4:]); int(size) != len(clean)-8 {
+		t.Fatalf("RIFF 长度 %d，期望 %d", size, len(clean)-8)
+	}
+}
+
+func TestProcessImageWebPThumbnail(t *testing.T) {
+	out, err := ProcessImage(webpFile(vp8lChunk(t, 40, 20)), testLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Image == nil {
+		t.Fatal("WebP 没有解码，无法生成缩略图")
+	}
+	thumb, ext, err := EncodeThumbnail(out.Image, out.Format, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil || ext != ".png" {
+		t.Fatalf("缩略图应为 PNG: %s %v", ext, err)
+	}
+	if cfg.Width != 10 || cfg.Height != 5 {
+		t.Fatalf("缩略图尺寸 %dx%d，期望 10x5", cfg.Width, cfg.Height)
+	}
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	data := commentGIF(t, 3, "hello")
+	if n, err := gifFrameCount(data); err != nil || n != 3 {
+		t.Fatalf("gifFrameCount = %d (%v)，期望 3", n, err)
+	}
+	// 缺少结束符时按已统计的帧数算
+	if n, err := gifFrameCount(data[:len(data)-1]); err != nil || n != 3 {
+		t.Fatalf("缺少结束符: gifFrameCount = %d (%v)，期望 3", n, err)
+	}
+}
+
+// 截断或构造异常的文件只能返回错误 (或按默认值处理)，不能 panic
+func TestImageParsersMalformedInput(t *testing.T) {
+	valid := map[string][]byte{
+		"jpeg": exifJPEG(t, twoColorImage(8, 8), 6, "gps"),
+		"png":  textPNG(t, twoColorImage(8, 8), "text"),
+		"gif":  commentGIF(t, 2, "comment"),
+		"webp": metadataWebP(t, 8, 8, "xmp"),
+	}
+	// WebP 截断在图像块结束之前时必须拒绝 (之后只剩元数据块，截掉仍是完整图片)
+	webpImageEnd := 12 + len(vp8xChunk(0, 8, 8)) + len(vp8lChunk(t, 8, 8))
+	for name, data := range valid {
+		for n := 0; n < len(data); n++ {
+			prefix := data[:n]
+			jpegOrientation(prefix)
+			stripWebP(prefix)
+			gifFrameCount(prefix)
+			if _, err := ProcessImage(prefix, testLimits); err == nil && name == "webp" && n < webpImageEnd {
+				t.Fatalf("截断到 %d 字节的 WebP 被接受", n)
+			}
+		}
+	}
+
+	// EXIF 中的 IFD 偏移、条目数超出数据范围
+	jpegWith := func(tiff string) []byte {
+		seg := "Exif\x00\x00" + tiff
+		app1 := append([]byte{0xFF, 0xD8, 0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(seg)+2))...)
+		return append(app1, seg...)
+	}
+	orientationCases := map[string][]byte{
+		"APP1 长度超出文件": {0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 'E', 'x'},
+		"APP1 长度小于 2": {0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01},
+		"IFD 偏移超大":    jpegWith("II*\x00\xFF\xFF\xFF\xFF"),
+		"IFD 条目数超大":   jpegWith("II*\x00\x08\x00\x00\x00\xFF\xFF"),
+		"未知字节序":       jpegWith("XX*\x00\x08\x00\x00\x00"),
+	}
+	for name, data := range orientationCases {
+		if o := jpegOrientation(data); o != 1 {
+			t.Fatalf("%s: Orientation = %d，期望按 1 处理", name, o)
+		}
+	}
+
+	webpCases := map[string][]byte{
+		"块长度超出文件":      append([]byte("RIFF\x00\x00\x00\x00WEBPVP8L"), 0xFF, 0xFF, 0xFF, 0xFF),
+		"VP8X 长度不足":    webpFile(webpChunk("VP8X", []byte{0x0C, 0, 0, 0})),
+		"VP8 头不完整":     webpFile(webpChunk("VP8 ", []byte{1, 2, 3})),
+		"VP8L 头不完整":    webpFile(webpChunk("VP8L", []byte{0x2F, 0})),
+		"只有 EXIF 没有图像": webpFile(webpChunk("EXIF", []byte("II*\x00"))),
+		"只有 VP8X 没有图像": webpFile(vp8xChunk(0x10, 8, 8)),
+	}
+	for name, data := range webpCases {
+		if _, _, _, err := stripWebP(data); err == nil {
+			t.Fatalf("%s: stripWebP 应返回错误", name)
+		}
+	}
+
+	gifHeader := "GIF89a\x08\x00\x08\x00"
+	gifCases := map[string][]byte{
+		"全局颜色表超出文件": []byte(gifHeader + "\x87\x00\x00"),
+		"图像描述符不完整":  []byte(gifHeader + "\x00\x00\x00\x2C\x00\x00"),
+		"扩展块子块不完整":  []byte(gifHeader + "\x00\x00\x00\x21\xFE\x05ab"),
+		"未知块":       []byte(gifHeader + "\x00\x00\x00\x99"),
+	}
+	for name, data := range gifCases {
+		if n, err := gifFrameCount(data); err == nil && n > 0 {
+			t.Fatalf("%s: gifFrameCount = %d，期望报错", name, n)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package utils
+
+import "strings"
+
+// likeEscaper 转义 LIKE 的通配符，配合 ESCAPE '\' 使用
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LikeContains 生成「包含 s」的 LIKE 模式，s 中的 % _ \ 按字面匹配
+// 查询条件须写成 `column LIKE ? ESCAPE '\'`
+func LikeContains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "testing"
+
+func TestLikeContains(t *testing.T) {
+	cases := map[string]string{
+		"键盘":      "%键盘%",
+		"100%":    `%100\%%`,
+		"a_b":     `%a\_b%`,
+		`C:\temp`: `%C:\\temp%`,
+		`\%_`:     `%\\\%\_%`,
+	}
+	for in, want := range cases {
+		if got := LikeContains(in); got != want {
+			t.Fatalf("LikeContains(%q) = %q, 期望 %q", in, got, want)
+		}
+	}
+}
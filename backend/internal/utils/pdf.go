@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf16"
+)
+
+// PDF 页面参数 (A4，单位 pt)
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+// pdfLine 一行待排版的文字
+type pdfLine struct {
+	Text string
+	Size float64
+}
+
+// PDFDocument 极简 PDF 生成器，只支持逐行写文字，够用来生成收据
+// 中文使用阅读器内置的 STSong-Light 字体 (UniGB-UCS2-H 编码)，无需嵌入字体文件
+type PDFDocument struct {
+	lines []pdfLine
+}
+
+// NewPDF 创建一个空白文档
+func NewPDF() *PDFDocument {
+	return &PDFDocument{}
+}
+
+// AddLine 追加一行文字，size 为字号；超出页宽或遇到换行符时自动折行
+func (d *PDFDocument) AddLine(text string, size float64) {
+	maxWidth := pdfPageWidth - 2*pdfMargin
+	var line []rune
+	width := 0.0
+	for _, r := range text {
+		if r == '\n' {
+			d.lines = append(d.lines, pdfLine{Text: string(line), Size: size})
+			line, width = nil, 0
+			continue
+		}
+		// 半角字符按半个字宽估算，其余按整字宽
+		w := size
+		if r < 0x80 {
+			w = size / 2
+		}
+		if width+w > maxWidth {
+			d.lines = append(d.lines, pdfLine{Text: string(line), Size: size})
+			line, width = nil, 0
+		}
+		line = append(line, r)
+		width += w
+	}
+	d.lines = append(d.lines, pdfLine{Text: string(line), Size: size})
+}
+
+// AddBlank 追加空行
+func (d *PDFDocument) AddBlank() {
+	d.lines = append(d.lines, pdfLine{Size: 12})
+}
+
+// Bytes 输出完整的 PDF 文件内容，超出一页时自动分页
+func (d *PDFDocument) Bytes() []byte {
+	// 1. 排版：把行切分到各页的内容流
+	var pages []string
+	var content bytes.Buffer
+	y := pdfPageHeight - pdfMargin
+	for _, line := range d.lines {
+		lead := line.Size * 1.6
+		if y-lead < pdfMargin {
+			pages = append(pages, content.String())
+			content.Reset()
+			y = pdfPageHeight - pdfMargin
+		}
+		y -= lead
+		if line.Text == "" {
+			continue
+		}
+		fmt.Fprintf(&content, "BT /F1 %.1f Tf %.1f %.1f Td <%s> Tj ET\n", line.Size, pdfMargin, y, pdfHexText(line.Text))
+	}
+	pages = append(pages, content.String())
+
+	// 2. 组装对象：1 目录, 2 页面树, 3-5 字体, 之后每页占两个对象 (页面 + 内容流)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // 页面树在知道页数后再填
+		"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>",
+		"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+	}
+	var kids bytes.Buffer
+	for _, stream := range pages {
+		pageID := len(objects) + 1
+		fmt.Fprintf(&kids, "%d 0 R ", pageID)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, pageID+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(stream), stream),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(pages))
+
+	// 3. 写文件体和交叉引用表
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfHexText 将文字编码为 UCS-2 大端十六进制串，超出基本平面的字符用 ? 代替
+func pdfHexText(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		if r > 0xFFFF {
+			r = '?'
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&buf, "%04X", u)
+		}
+	}
+	return buf.String()
+}
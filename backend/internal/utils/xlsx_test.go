@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestSpreadsheetText(t *testing.T) {
+	cases := map[string]string{
+		"":                        "",
+		"二手自行车":                   "二手自行车",
+		"=HYPERLINK(\"x\",\"y\")": "'=HYPERLINK(\"x\",\"y\")",
+		"+1":                      "'+1",
+		"-2+3":                    "'-2+3",
+		"@SUM(A1)":                "'@SUM(A1)",
+		"\t=1":                    "'\t=1",
+		"a=1":                     "a=1",
+	}
+	for in, want := range cases {
+		if got := SpreadsheetText(in); got != want {
+			t.Errorf("SpreadsheetText(%q) = %q, 期望 %q", in, got, want)
+		}
+	}
+}
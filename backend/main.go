@@ -6,11 +6,12 @@ import (
 	"gotest/config"
 	"gotest/internal/controllers"
 	"gotest/internal/middleware"
+	"gotest/internal/services"
 	"gotest/pkg/ws"
 	"io/fs"
+	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -47,24 +48,25 @@ func main() {
 	workDir, _ := os.Getwd()
 	fmt.Println(">>> Current working directory:", workDir)
 
-	// 3. Init DB
+	// 3. Init upload storage (local dir or S3, see config/storage.go)
+	// Must run before InitDB: the data migrations rewrite upload URLs via the storage
+	config.InitStorage()
+
+	// 4. Init DB
 	config.InitDB()
 
-	// 4. Create uploads dir
-	uploadDir := filepath.Join(workDir, "uploads")
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.MkdirAll(uploadDir, 0755)
+	// 5. Init chat broker (in-process, or Redis when running several instances) and WebSocket Hub
+	config.InitBroker()
+	hub := ws.NewHub(config.Broker)
+	if err := hub.Subscribe(); err != nil {
+		log.Fatal("❌ 订阅消息总线失败: ", err)
 	}
-
-	// 5. Init WebSocket Hub
-	hub := ws.NewHub()
 	go hub.Run()
 
 	// 6. Init Gin
 	r := gin.Default()
 	r.MaxMultipartMemory = 8 << 20
 	r.Use(CORSMiddleware())
-	r.StaticFS("/uploads", gin.Dir(uploadDir, true))
 
 	// 7. Frontend Hosting
 	frontendFS, err := fs.Sub(content, "dist")
@@ -89,15 +91,37 @@ func main() {
 		})
 	}
 
+	// 8. Init Services (only those that need the hub)
+	notificationService := &services.NotificationService{Hub: hub}
+
+	// Chat messages are checked against block lists and privacy settings before they are saved
+	ws.UseMessageFilter(new(services.PrivacyService).MessageFilter)
+
+	// Sensitive words and scam patterns are masked or rejected before saving; flagged messages go to the review queue
+	moderationService := new(services.ModerationService)
+	ws.UseMessageFilter(moderationService.MessageFilter)
+	ws.UseMessageHook(moderationService.MessageHook)
+
+	// Periodically remove uploads no longer referenced by products, avatars or messages
+	new(services.UploadService).StartCleanup(config.Upload.CleanupInterval, config.Upload.OrphanGrace)
+
 	// 9. Initialize Controllers (No Service injection for ChatController)
 	chatController := &controllers.ChatController{Hub: hub}
 	userController := new(controllers.UserController)
-	productController := new(controllers.ProductController)
+	productController := &controllers.ProductController{Notifier: notificationService}
 	fileController := new(controllers.FileController)
-	orderController := new(controllers.OrderController)
+	orderController := &controllers.OrderController{Notifier: notificationService}
 	cartController := new(controllers.CartController)
+	checkoutController := new(controllers.CheckoutController)
+	notificationController := &controllers.NotificationController{Service: notificationService}
 	adminController := new(controllers.AdminController)
 
+	// Uploaded files are served through the storage backend
+	r.GET("/uploads/*key", fileController.Serve)
+	r.HEAD("/uploads/*key", fileController.Serve)
+	// Private attachments (chat images, evidence) require a signed, expiring URL
+	r.GET("/private/*key", fileController.ServePrivate)
+
 	// 10. API Routes
 	api := r.Group("/api")
 	{
@@ -107,8 +131,9 @@ func main() {
 		// WebSocket Endpoint
 		api.GET("/ws", chatController.Connect)
 
-		api.GET("/products", productController.List)
-		api.GET("/products/:id", productController.GetDetail)
+		// Public, but a logged-in viewer no longer sees listings of sellers who blocked them
+		api.GET("/products", middleware.OptionalAuth(), productController.List)
+		api.GET("/products/:id", middleware.OptionalAuth(), productController.GetDetail)
 		api.GET("/categories", productController.Categories)
 
 		// Protected Routes
@@ -117,8 +142,14 @@ func main() {
 			userGroup.GET("/user/data", userController.GetMyData)
 			userGroup.PUT("/user/profile", userController.UpdateProfile)
 			userGroup.PUT("/user/password", userController.ChangePassword)
+			userGroup.PUT("/user/privacy", userController.UpdatePrivacy)
+			userGroup.GET("/user/blocks", userController.ListBlocks)
+			userGroup.POST("/user/blocks", userController.Block)
+			userGroup.DELETE("/user/blocks/:id", userController.Unblock)
 			userGroup.GET("/user/favorite/check", userController.CheckFavorite)
 			userGroup.POST("/user/favorite", userController.ToggleFavorite)
+			userGroup.GET("/notifications", notificationController.List)
+			userGroup.PUT("/notifications/:id/read", notificationController.MarkRead)
 
 			// ★★★ 新增路由：获取指定用户信息 (用于聊天显示) ★★★
 			userGroup.GET("/users/:id", userController.GetUserInfo)
@@ -127,17 +158,33 @@ func main() {
 			{
 				chatGroup.GET("/contacts", chatController.GetContacts)
 				chatGroup.GET("/messages", chatController.GetHistory)
+				chatGroup.GET("/messages/:id/context", chatController.MessageContext)
+				chatGroup.GET("/search", chatController.SearchMessages)
+				chatGroup.GET("/media", chatController.GetMedia)
+				chatGroup.POST("/messages/:id/recall", chatController.RecallMessage)
+				chatGroup.DELETE("/messages/:id", chatController.DeleteMessage)
+				chatGroup.GET("/online", chatController.Online)
+				chatGroup.POST("/conversations", chatController.OpenConversation)
+				chatGroup.PUT("/conversations/:target_id/read", chatController.MarkRead)
 			}
 
 			userGroup.POST("/upload", fileController.Upload)
+			userGroup.GET("/files/sign", fileController.SignURL)
 			userGroup.POST("/products", productController.Create)
 			userGroup.PUT("/products/:id", productController.Update)
+			userGroup.DELETE("/products/:id", productController.Delete)
 			userGroup.POST("/orders", orderController.Create)
 			userGroup.POST("/orders/batch", orderController.BatchCreate)
 			userGroup.GET("/orders", orderController.List)
+			userGroup.GET("/orders/export", orderController.Export)
+			userGroup.GET("/orders/:id/receipt", orderController.Receipt)
 			userGroup.POST("/orders/:id/pay", orderController.Pay)
+			userGroup.POST("/orders/:id/cancel", orderController.Cancel)
+			userGroup.GET("/checkouts/:id", checkoutController.Detail)
+			userGroup.POST("/checkouts/:id/pay", checkoutController.Pay)
 			userGroup.POST("/cart", cartController.Add)
 			userGroup.GET("/cart", cartController.List)
+			userGroup.DELETE("/cart/invalid", cartController.RemoveInvalid)
 			userGroup.DELETE("/cart/:id", cartController.Delete)
 		}
 
@@ -155,6 +202,17 @@ func main() {
 				authGroup.GET("/products", adminController.GetProducts)
 				authGroup.PUT("/products/:id/audit", adminController.AuditProduct)
 				authGroup.GET("/orders", adminController.GetOrders)
+				authGroup.GET("/categories", adminController.GetCategories)
+				authGroup.POST("/categories", adminController.CreateCategory)
+				authGroup.PUT("/categories/:id", adminController.UpdateCategory)
+				authGroup.DELETE("/categories/:id", adminController.DeleteCategory)
+				authGroup.GET("/storage", adminController.GetStorage)
+				authGroup.GET("/moderation/rules", adminController.GetModerationRules)
+				authGroup.POST("/moderation/rules", adminController.CreateModerationRule)
+				authGroup.PUT("/moderation/rules/:id", adminController.UpdateModerationRule)
+				authGroup.DELETE("/moderation/rules/:id", adminController.DeleteModerationRule)
+				authGroup.GET("/moderation/flags", adminController.GetModerationFlags)
+				authGroup.PUT("/moderation/flags/:id", adminController.ReviewModerationFlag)
 			}
 		}
 	}
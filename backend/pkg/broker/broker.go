@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Broker 多个后端实例之间的消息总线和在线状态
+// 每个实例的 WebSocket Hub 只持有连到自己的连接，发给其他实例上用户的消息通过 Broker 转发
+type Broker interface {
+	// Publish 发布到主题，所有实例 (包括自己) 的订阅者都会收到
+	Publish(topic string, data []byte) error
+	// Subscribe 订阅主题；同一主题的消息按发布顺序串行回调 handler
+	// 订阅断线后重新订阅成功时回调 resumed (可为 nil)，断线期间发布的消息已经丢失，由订阅方自行补发
+	Subscribe(topic string, handler func(data []byte), resumed func()) error
+	// SetPresence 记录本实例上某用户的在线设备数，0 表示该用户已从本实例下线
+	SetPresence(userID uint, devices int) error
+	// Devices 用户在所有实例上的在线设备总数
+	Devices(userID uint) (int, error)
+	// DevicesOf 批量查询多个用户的在线设备总数 (联系人列表等一次查多人时使用)，离线用户不在结果中
+	DevicesOf(userIDs []uint) (map[uint]int, error)
+	// NodeID 当前实例 ID
+	NodeID() string
+	// Close 停止订阅并清除本实例的在线状态
+	Close() error
+}
+
+// ErrClosed 消息总线已关闭
+var ErrClosed = errors.New("消息总线已关闭")
+
+// Config 消息总线配置
+type Config struct {
+	Driver string // memory (默认，单实例) 或 redis
+	NodeID string // 实例 ID，为空时使用 主机名-进程号
+
+	// Redis (或兼容 RESP 协议的服务)
+	RedisAddr     string        // 默认 127.0.0.1:6379
+	RedisPassword string        // 为空时不认证
+	RedisDB       int           // 默认 0
+	RedisPrefix   string        // key / 频道前缀，默认 xianqu
+	NodeTTL       time.Duration // 实例心跳过期时间，超时未续期的实例视为宕机，其在线状态不再计入；默认 30 秒
+}
+
+// New 按配置创建消息总线
+func New(cfg Config) (Broker, error) {
+	if cfg.NodeID == "" {
+		host, _ := os.Hostname()
+		cfg.NodeID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	switch cfg.Driver {
+	case "", "memory":
+		return NewMemory(cfg.NodeID), nil
+	case "redis":
+		return NewRedis(cfg)
+	}
+	return nil, errors.New("未知的消息总线驱动: " + cfg.Driver)
+}
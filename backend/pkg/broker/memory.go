@@ -0,0 +1,114 @@
+package broker
+
+import "sync"
+
+// Memory 单实例模式的进程内消息总线
+type Memory struct {
+	node string
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []published // 待分发的消息，不限长度，Publish 不会因订阅者处理慢而阻塞
+	handlers map[string][]func([]byte)
+	presence map[uint]int
+	closed   bool
+}
+
+type published struct {
+	topic string
+	data  []byte
+}
+
+// NewMemory 创建进程内消息总线，消息由单独的 goroutine 按发布顺序分发
+func NewMemory(nodeID string) *Memory {
+	m := &Memory{
+		node:     nodeID,
+		handlers: make(map[string][]func([]byte)),
+		presence: make(map[uint]int),
+	}
+	m.cond = sync.NewCond(&m.mu)
+	go m.dispatch()
+	return m
+}
+
+func (m *Memory) Publish(topic string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.queue = append(m.queue, published{topic: topic, data: data})
+	m.cond.Signal()
+	return nil
+}
+
+// Subscribe 进程内总线不会断线，resumed 不会被回调
+func (m *Memory) Subscribe(topic string, handler func(data []byte), resumed func()) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[topic] = append(m.handlers[topic], handler)
+	return nil
+}
+
+// dispatch 依次取出消息并回调订阅者
+func (m *Memory) dispatch() {
+	for {
+		m.mu.Lock()
+		for len(m.queue) == 0 && !m.closed {
+			m.cond.Wait()
+		}
+		if m.closed {
+			m.mu.Unlock()
+			return
+		}
+		msg := m.queue[0]
+		m.queue = m.queue[1:]
+		handlers := m.handlers[msg.topic]
+		m.mu.Unlock()
+
+		for _, h := range handlers {
+			h(msg.data)
+		}
+	}
+}
+
+func (m *Memory) SetPresence(userID uint, devices int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if devices <= 0 {
+		delete(m.presence, userID)
+	} else {
+		m.presence[userID] = devices
+	}
+	return nil
+}
+
+func (m *Memory) Devices(userID uint) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.presence[userID], nil
+}
+
+func (m *Memory) DevicesOf(userIDs []uint) (map[uint]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[uint]int, len(userIDs))
+	for _, id := range userIDs {
+		if n := m.presence[id]; n > 0 {
+			result[id] = n
+		}
+	}
+	return result, nil
+}
+
+func (m *Memory) NodeID() string {
+	return m.node
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,95 @@
+package broker
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryPublishOrder(t *testing.T) {
+	m := NewMemory("test")
+	defer m.Close()
+
+	const n = 1000
+	var mu sync.Mutex
+	got := map[string][]string{}
+	done := make(chan struct{}, 2)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		m.Subscribe("chat", func(data []byte) {
+			mu.Lock()
+			got[name] = append(got[name], string(data))
+			full := len(got[name]) == n
+			mu.Unlock()
+			if full {
+				done <- struct{}{}
+			}
+		}, nil)
+	}
+	m.Subscribe("other", func(data []byte) {
+		t.Errorf("其他主题收到了消息: %s", data)
+	}, nil)
+
+	for i := 0; i < n; i++ {
+		if err := m.Publish("chat", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("订阅者没有收到全部消息")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for name, msgs := range got {
+		for i, msg := range msgs {
+			if msg != strconv.Itoa(i) {
+				t.Fatalf("订阅者 %s 第 %d 条消息为 %s，顺序错乱", name, i, msg)
+			}
+		}
+	}
+}
+
+func TestMemoryPublishDoesNotBlockOnSlowSubscriber(t *testing.T) {
+	m := NewMemory("test")
+	defer m.Close()
+
+	release := make(chan struct{})
+	m.Subscribe("chat", func([]byte) { <-release }, nil)
+	defer close(release)
+
+	finished := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			m.Publish("chat", []byte("x"))
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("订阅者处理慢时 Publish 被阻塞")
+	}
+}
+
+func TestMemoryPresence(t *testing.T) {
+	m := NewMemory("test")
+	defer m.Close()
+
+	m.SetPresence(1, 2)
+	if n, _ := m.Devices(1); n != 2 {
+		t.Fatalf("Devices = %d, 期望 2", n)
+	}
+	if devices, _ := m.DevicesOf([]uint{1, 2}); len(devices) != 1 || devices[1] != 2 {
+		t.Fatalf("DevicesOf = %v, 期望 map[1:2]", devices)
+	}
+	m.SetPresence(1, 0)
+	if n, _ := m.Devices(1); n != 0 {
+		t.Fatalf("下线后 Devices = %d, 期望 0", n)
+	}
+}
@@ -0,0 +1,366 @@
+package broker
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Redis 基于 Redis pub/sub 的消息总线，用于多实例部署
+// 频道：<prefix>:<topic>
+// 在线状态：<prefix>:presence:<userID> 哈希，字段为实例 ID，值为该实例上的设备数
+// 实例心跳：<prefix>:node:<nodeID>，带过期时间，过期实例的在线状态不再计入 (实例宕机时不会留下“永远在线”的用户)
+type Redis struct {
+	cfg Config
+
+	// 命令连接，所有命令串行发送，本实例发布的消息在频道中的顺序与调用顺序一致
+	mu  sync.Mutex
+	cmd *respConn
+
+	// 本实例登记的在线状态，Redis 重启丢数据后由心跳补写，Close 时清除
+	presenceMu sync.Mutex
+	presence   map[uint]int
+
+	subMu sync.Mutex
+	subs  []*respConn
+	done  chan struct{}
+}
+
+// NewRedis 连接 Redis 并启动实例心跳
+func NewRedis(cfg Config) (*Redis, error) {
+	if cfg.RedisAddr == "" {
+		cfg.RedisAddr = "127.0.0.1:6379"
+	}
+	if cfg.RedisPrefix == "" {
+		cfg.RedisPrefix = "xianqu"
+	}
+	if cfg.NodeTTL <= 0 {
+		cfg.NodeTTL = 30 * time.Second
+	}
+	r := &Redis{cfg: cfg, presence: make(map[uint]int), done: make(chan struct{})}
+	if _, err := r.do("PING"); err != nil {
+		return nil, err
+	}
+	r.heartbeat()
+	go func() {
+		ticker := time.NewTicker(cfg.NodeTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				r.heartbeat()
+			}
+		}
+	}()
+	return r, nil
+}
+
+func (r *Redis) key(parts ...string) string {
+	k := r.cfg.RedisPrefix
+	for _, p := range parts {
+		k += ":" + p
+	}
+	return k
+}
+
+func (r *Redis) presenceKey(userID uint) string {
+	return r.key("presence", strconv.FormatUint(uint64(userID), 10))
+}
+
+// do 在命令连接上执行命令，连接出错时丢弃，下次调用重新连接
+func (r *Redis) do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cmd == nil {
+		conn, err := dialRESP(r.cfg.RedisAddr, r.cfg.RedisPassword, r.cfg.RedisDB)
+		if err != nil {
+			return nil, err
+		}
+		r.cmd = conn
+	}
+	reply, err := r.cmd.do(args...)
+	if err != nil {
+		if _, ok := err.(respError); !ok {
+			r.cmd.Close()
+			r.cmd = nil
+		}
+	}
+	return reply, err
+}
+
+// pipeline 在命令连接上批量执行命令，出错处理同 do
+func (r *Redis) pipeline(cmds [][]string) ([]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cmd == nil {
+		conn, err := dialRESP(r.cfg.RedisAddr, r.cfg.RedisPassword, r.cfg.RedisDB)
+		if err != nil {
+			return nil, err
+		}
+		r.cmd = conn
+	}
+	replies, err := r.cmd.pipeline(cmds)
+	if err != nil {
+		if _, ok := err.(respError); !ok {
+			r.cmd.Close()
+			r.cmd = nil
+		}
+	}
+	return replies, err
+}
+
+// heartbeat 续期实例心跳；心跳 key 不存在 (首次启动或 Redis 重启) 时补写本实例的在线状态
+func (r *Redis) heartbeat() {
+	nodeKey := r.key("node", r.cfg.NodeID)
+	reply, err := r.do("EXISTS", nodeKey)
+	if err != nil {
+		log.Println("Broker: 心跳失败:", err)
+		return
+	}
+	ttl := strconv.Itoa(int(r.cfg.NodeTTL / time.Second))
+	if _, err := r.do("SET", nodeKey, "1", "EX", ttl); err != nil {
+		log.Println("Broker: 心跳失败:", err)
+		return
+	}
+	if n, _ := reply.(int64); n == 0 {
+		r.presenceMu.Lock()
+		snapshot := make(map[uint]int, len(r.presence))
+		for id, devices := range r.presence {
+			snapshot[id] = devices
+		}
+		r.presenceMu.Unlock()
+		for id, devices := range snapshot {
+			r.do("HSET", r.presenceKey(id), r.cfg.NodeID, strconv.Itoa(devices))
+		}
+	}
+}
+
+func (r *Redis) Publish(topic string, data []byte) error {
+	_, err := r.do("PUBLISH", r.key(topic), string(data))
+	return err
+}
+
+// Subscribe 每个主题使用单独的订阅连接，断线后自动重连
+// 订阅连接上的消息按 Redis 的投递顺序串行回调；pub/sub 不保存消息，断线期间发布的消息会丢失，
+// 而浏览器到本实例的 WebSocket 并没有断开，前端不会自己重连补发，所以重新订阅成功后回调 resumed 通知订阅方补发
+func (r *Redis) Subscribe(topic string, handler func(data []byte), resumed func()) error {
+	conn, err := r.subscribe(topic)
+	if err != nil {
+		return err
+	}
+	go func() {
+		backoff := time.Second
+		for {
+			if conn != nil {
+				backoff = time.Second
+				r.receive(conn, handler)
+			}
+			select {
+			case <-r.done:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < 10*time.Second {
+				backoff *= 2
+			}
+			if conn, err = r.subscribe(topic); err != nil {
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+				log.Println("Broker: 重新订阅失败:", err)
+				continue
+			}
+			log.Println("Broker: 已重新订阅", topic)
+			if resumed != nil {
+				resumed()
+			}
+		}
+	}()
+	return nil
+}
+
+// subscribe 建立订阅连接并确认订阅成功
+func (r *Redis) subscribe(topic string) (*respConn, error) {
+	conn, err := dialRESP(r.cfg.RedisAddr, r.cfg.RedisPassword, r.cfg.RedisDB)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.do("SUBSCRIBE", r.key(topic)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// 与 Close 互斥：Close 已经关闭了全部订阅连接时，新建的连接不能再登记，否则不会被关闭
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+	select {
+	case <-r.done:
+		conn.Close()
+		return nil, ErrClosed
+	default:
+	}
+	r.subs = append(r.subs, conn)
+	return conn, nil
+}
+
+// receive 读取订阅消息直到连接断开
+func (r *Redis) receive(conn *respConn, handler func([]byte)) {
+	defer func() {
+		conn.Close()
+		r.subMu.Lock()
+		for i, c := range r.subs {
+			if c == conn {
+				r.subs = append(r.subs[:i], r.subs[i+1:]...)
+				break
+			}
+		}
+		r.subMu.Unlock()
+	}()
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			select {
+			case <-r.done:
+			default:
+				log.Println("Broker: 订阅连接断开:", err)
+			}
+			return
+		}
+		// ["message", channel, payload]
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 || items[0] != "message" {
+			continue
+		}
+		if payload, ok := items[2].(string); ok {
+			handler([]byte(payload))
+		}
+	}
+}
+
+func (r *Redis) SetPresence(userID uint, devices int) error {
+	r.presenceMu.Lock()
+	if devices <= 0 {
+		delete(r.presence, userID)
+	} else {
+		r.presence[userID] = devices
+	}
+	r.presenceMu.Unlock()
+
+	if devices <= 0 {
+		_, err := r.do("HDEL", r.presenceKey(userID), r.cfg.NodeID)
+		return err
+	}
+	_, err := r.do("HSET", r.presenceKey(userID), r.cfg.NodeID, strconv.Itoa(devices))
+	return err
+}
+
+// Devices 汇总各实例上的设备数，顺带清理已宕机实例留下的记录
+func (r *Redis) Devices(userID uint) (int, error) {
+	devices, err := r.DevicesOf([]uint{userID})
+	return devices[userID], err
+}
+
+// DevicesOf 批量汇总：一次往返取出所有用户的在线哈希，再用一条 MGET 检查涉及的实例是否存活
+func (r *Redis) DevicesOf(userIDs []uint) (map[uint]int, error) {
+	result := make(map[uint]int, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	cmds := make([][]string, len(userIDs))
+	for i, id := range userIDs {
+		cmds[i] = []string{"HGETALL", r.presenceKey(id)}
+	}
+	replies, err := r.pipeline(cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	// 用户 -> 实例 -> 设备数
+	perNode := make([]map[string]int, len(userIDs))
+	var others []string
+	seen := map[string]bool{r.cfg.NodeID: true}
+	for i, reply := range replies {
+		items, _ := reply.([]interface{})
+		perNode[i] = make(map[string]int, len(items)/2)
+		for j := 0; j+1 < len(items); j += 2 {
+			node, _ := items[j].(string)
+			value, _ := items[j+1].(string)
+			perNode[i][node], _ = strconv.Atoi(value)
+			if !seen[node] {
+				seen[node] = true
+				others = append(others, node)
+			}
+		}
+	}
+
+	alive := map[string]bool{r.cfg.NodeID: true}
+	if len(others) > 0 {
+		args := []string{"MGET"}
+		for _, node := range others {
+			args = append(args, r.key("node", node))
+		}
+		reply, err := r.do(args...)
+		if err != nil {
+			return nil, err
+		}
+		values, _ := reply.([]interface{})
+		for i, v := range values {
+			if v != nil && i < len(others) {
+				alive[others[i]] = true
+			}
+		}
+	}
+
+	for i, id := range userIDs {
+		total := 0
+		for node, devices := range perNode[i] {
+			if !alive[node] {
+				r.do("HDEL", r.presenceKey(id), node)
+				continue
+			}
+			total += devices
+		}
+		if total > 0 {
+			result[id] = total
+		}
+	}
+	return result, nil
+}
+
+func (r *Redis) NodeID() string {
+	return r.cfg.NodeID
+}
+
+func (r *Redis) Close() error {
+	close(r.done)
+
+	r.subMu.Lock()
+	for _, conn := range r.subs {
+		conn.Close()
+	}
+	r.subs = nil
+	r.subMu.Unlock()
+
+	r.presenceMu.Lock()
+	users := make([]uint, 0, len(r.presence))
+	for id := range r.presence {
+		users = append(users, id)
+	}
+	r.presence = make(map[uint]int)
+	r.presenceMu.Unlock()
+	for _, id := range users {
+		r.do("HDEL", r.presenceKey(id), r.cfg.NodeID)
+	}
+	_, err := r.do("DEL", r.key("node", r.cfg.NodeID))
+
+	r.mu.Lock()
+	if r.cmd != nil {
+		r.cmd.Close()
+		r.cmd = nil
+	}
+	r.mu.Unlock()
+	return err
+}
@@ -0,0 +1,400 @@
+package broker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 只实现本包用到的命令的 RESP 服务端
+type fakeRedis struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	strings map[string]string
+	hashes  map[string]map[string]string
+	subs    map[string][]*fakeConn // 频道 -> 订阅连接
+}
+
+type fakeConn struct {
+	net.Conn
+	mu sync.Mutex // 发布与订阅回复可能并发写同一连接
+}
+
+func (c *fakeConn) reply(v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Write(encodeRESP(nil, v))
+}
+
+func encodeRESP(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "$-1\r\n"...)
+	case error:
+		return append(buf, "-"+v.Error()+"\r\n"...)
+	case int:
+		return append(buf, ":"+strconv.Itoa(v)+"\r\n"...)
+	case string:
+		return append(buf, "$"+strconv.Itoa(len(v))+"\r\n"+v+"\r\n"...)
+	case []interface{}:
+		buf = append(buf, "*"+strconv.Itoa(len(v))+"\r\n"...)
+		for _, item := range v {
+			buf = encodeRESP(buf, item)
+		}
+		return buf
+	}
+	panic("不支持的回复类型")
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{
+		ln:      ln,
+		strings: make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		subs:    make(map[string][]*fakeConn),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(&fakeConn{Conn: conn})
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) addr() string {
+	return s.ln.Addr().String()
+}
+
+// serve 读取命令 (bulk string 数组) 并执行
+func (s *fakeRedis) serve(c *fakeConn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.exec(c, args)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(line[1 : len(line)-2])
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(line[1 : len(line)-2])
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) exec(c *fakeConn, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch args[0] {
+	case "PING":
+		c.reply("PONG")
+	case "SET":
+		s.strings[args[1]] = args[2]
+		c.reply("OK")
+	case "EXISTS":
+		_, ok := s.strings[args[1]]
+		c.reply(map[bool]int{true: 1, false: 0}[ok])
+	case "MGET":
+		values := make([]interface{}, len(args)-1)
+		for i, key := range args[1:] {
+			if v, ok := s.strings[key]; ok {
+				values[i] = v
+			}
+		}
+		c.reply(values)
+	case "DEL":
+		delete(s.strings, args[1])
+		delete(s.hashes, args[1])
+		c.reply(1)
+	case "HSET":
+		if s.hashes[args[1]] == nil {
+			s.hashes[args[1]] = make(map[string]string)
+		}
+		s.hashes[args[1]][args[2]] = args[3]
+		c.reply(1)
+	case "HDEL":
+		delete(s.hashes[args[1]], args[2])
+		c.reply(1)
+	case "HGETALL":
+		var items []interface{}
+		for k, v := range s.hashes[args[1]] {
+			items = append(items, k, v)
+		}
+		c.reply(items)
+	case "SUBSCRIBE":
+		s.subs[args[1]] = append(s.subs[args[1]], c)
+		c.reply([]interface{}{"subscribe", args[1], 1})
+	case "PUBLISH":
+		// 持有 s.mu 依次写给订阅者，保证投递顺序与发布顺序一致
+		subs := s.subs[args[1]]
+		for _, sub := range subs {
+			sub.reply([]interface{}{"message", args[1], args[2]})
+		}
+		c.reply(len(subs))
+	default:
+		c.reply(statusError("ERR unknown command " + args[0]))
+	}
+}
+
+type statusError string
+
+func (e statusError) Error() string { return string(e) }
+
+// dropSubscribers 断开所有订阅连接，模拟网络中断
+func (s *fakeRedis) dropSubscribers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for channel, conns := range s.subs {
+		for _, c := range conns {
+			c.Close()
+		}
+		delete(s.subs, channel)
+	}
+}
+
+// expire 删除 key，模拟实例心跳过期
+func (s *fakeRedis) expire(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.strings, key)
+}
+
+func newTestRedis(t *testing.T, s *fakeRedis, node string) *Redis {
+	t.Helper()
+	r, err := NewRedis(Config{NodeID: node, RedisAddr: s.addr(), NodeTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// collector 收集订阅到的消息
+type collector struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (c *collector) handle(data []byte) {
+	c.mu.Lock()
+	c.msgs = append(c.msgs, string(data))
+	c.mu.Unlock()
+}
+
+func (c *collector) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		c.mu.Lock()
+		if len(c.msgs) >= n {
+			msgs := append([]string(nil), c.msgs...)
+			c.mu.Unlock()
+			return msgs
+		}
+		c.mu.Unlock()
+		if time.Now().After(deadline) {
+			t.Fatalf("只收到 %d 条消息，期望 %d 条", len(c.msgs), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRedisPublishSubscribeOrder(t *testing.T) {
+	s := newFakeRedis(t)
+	a := newTestRedis(t, s, "a")
+	b := newTestRedis(t, s, "b")
+
+	var onA, onB collector
+	if err := a.Subscribe("chat", onA.handle, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Subscribe("chat", onB.handle, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		if err := a.Publish("chat", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 发布者自己和其他实例都按发布顺序收到
+	for name, c := range map[string]*collector{"a": &onA, "b": &onB} {
+		for i, msg := range c.wait(t, n) {
+			if msg != strconv.Itoa(i) {
+				t.Fatalf("实例 %s 第 %d 条消息为 %s，顺序错乱", name, i, msg)
+			}
+		}
+	}
+}
+
+func TestRedisPresenceAggregation(t *testing.T) {
+	s := newFakeRedis(t)
+	a := newTestRedis(t, s, "a")
+	b := newTestRedis(t, s, "b")
+
+	a.SetPresence(1, 2)
+	b.SetPresence(1, 1)
+	for _, r := range []*Redis{a, b} {
+		if n, err := r.Devices(1); err != nil || n != 3 {
+			t.Fatalf("实例 %s: Devices = %d (%v), 期望 3", r.NodeID(), n, err)
+		}
+	}
+
+	// 某实例上的设备全部下线
+	b.SetPresence(1, 0)
+	if n, _ := a.Devices(1); n != 2 {
+		t.Fatalf("Devices = %d, 期望 2", n)
+	}
+
+	// 实例 a 宕机 (心跳过期)，它登记的设备不再计入，记录顺带被清理
+	s.expire("xianqu:node:a")
+	if n, _ := b.Devices(1); n != 0 {
+		t.Fatalf("宕机实例的设备仍被计入: Devices = %d", n)
+	}
+	s.mu.Lock()
+	_, left := s.hashes["xianqu:presence:1"]["a"]
+	s.mu.Unlock()
+	if left {
+		t.Fatal("宕机实例的在线记录没有被清理")
+	}
+}
+
+func TestRedisDevicesOf(t *testing.T) {
+	s := newFakeRedis(t)
+	a := newTestRedis(t, s, "a")
+	b := newTestRedis(t, s, "b")
+	c := newTestRedis(t, s, "c")
+
+	a.SetPresence(1, 2)
+	b.SetPresence(1, 1)
+	b.SetPresence(2, 1)
+	c.SetPresence(3, 1)
+	s.expire("xianqu:node:c")
+
+	devices, err := a.DevicesOf([]uint{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint]int{1: 3, 2: 1}
+	if len(devices) != len(want) {
+		t.Fatalf("DevicesOf = %v, 期望 %v", devices, want)
+	}
+	for id, n := range want {
+		if devices[id] != n {
+			t.Fatalf("DevicesOf = %v, 期望 %v", devices, want)
+		}
+	}
+	s.mu.Lock()
+	_, left := s.hashes["xianqu:presence:3"]["c"]
+	s.mu.Unlock()
+	if left {
+		t.Fatal("宕机实例的在线记录没有被清理")
+	}
+
+	if devices, err := a.DevicesOf(nil); err != nil || len(devices) != 0 {
+		t.Fatalf("DevicesOf(nil) = %v (%v)", devices, err)
+	}
+}
+
+func TestRedisSubscribeAfterClose(t *testing.T) {
+	s := newFakeRedis(t)
+	r, err := NewRedis(Config{NodeID: "a", RedisAddr: s.addr(), NodeTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	// 关闭后建立的订阅连接不能留在 subs 里无人关闭
+	if _, err := r.subscribe("chat"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("subscribe 返回 %v, 期望 ErrClosed", err)
+	}
+	r.subMu.Lock()
+	n := len(r.subs)
+	r.subMu.Unlock()
+	if n != 0 {
+		t.Fatalf("关闭后仍登记了 %d 个订阅连接", n)
+	}
+}
+
+func TestRedisCloseClearsPresence(t *testing.T) {
+	s := newFakeRedis(t)
+	a, err := NewRedis(Config{NodeID: "a", RedisAddr: s.addr(), NodeTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newTestRedis(t, s, "b")
+
+	a.SetPresence(1, 2)
+	b.SetPresence(1, 1)
+	a.Close()
+	if n, _ := b.Devices(1); n != 1 {
+		t.Fatalf("Devices = %d, 期望 1", n)
+	}
+}
+
+func TestRedisResubscribeAfterDisconnect(t *testing.T) {
+	s := newFakeRedis(t)
+	a := newTestRedis(t, s, "a")
+	b := newTestRedis(t, s, "b")
+
+	var got collector
+	resumed := make(chan struct{}, 1)
+	err := b.Subscribe("chat", got.handle, func() { resumed <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Publish("chat", []byte("before"))
+	got.wait(t, 1)
+
+	// 订阅连接断开期间发布的消息丢失，重新订阅后回调 resumed 让订阅方补发
+	s.dropSubscribers()
+	a.Publish("chat", []byte("lost"))
+	select {
+	case <-resumed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("断线后没有重新订阅")
+	}
+
+	a.Publish("chat", []byte("after"))
+	msgs := got.wait(t, 2)
+	if msgs[1] != "after" {
+		t.Fatalf("重新订阅后收到 %v", msgs)
+	}
+}
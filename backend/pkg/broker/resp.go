@@ -0,0 +1,161 @@
+package broker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// respConn 最小的 RESP (Redis 协议) 连接，只实现本包用到的命令
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// respError 服务端返回的错误回复 (-ERR ...)
+type respError string
+
+func (e respError) Error() string {
+	return "redis: " + string(e)
+}
+
+// dialRESP 建立连接，按需认证并切换数据库
+func dialRESP(addr, password string, db int) (*respConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &respConn{conn: conn, r: bufio.NewReader(conn)}
+	if password != "" {
+		if _, err := c.do("AUTH", password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do 发送命令并读取一条回复 (5 秒超时)
+func (c *respConn) do(args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// pipeline 一次写入多条命令再依次读取回复，只有一次网络往返
+// 某条命令返回错误回复时继续读完其余回复，返回第一个错误
+func (c *respConn) pipeline(cmds [][]string) ([]interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+	var buf []byte
+	for _, args := range cmds {
+		buf = appendCommand(buf, args)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range replies {
+		reply, err := c.read()
+		if err != nil {
+			if _, ok := err.(respError); !ok {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// send 以 bulk string 数组的形式写入命令
+func (c *respConn) send(args ...string) error {
+	_, err := c.conn.Write(appendCommand(make([]byte, 0, 64), args))
+	return err
+}
+
+// appendCommand 把一条命令编码后追加到 buf
+func appendCommand(buf []byte, args []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// read 读取一条回复：简单字符串和 bulk string 返回 string，整数返回 int64，
+// 数组返回 []interface{}，空值返回 nil，错误回复返回 respError
+func (c *respConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: 无效的回复")
+	}
+	body := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, respError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: 未知的回复类型 %q", line[0])
+}
+
+func (c *respConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,203 @@
+// Package moderation 敏感词与诈骗话术过滤
+// 关键词用 Aho–Corasick 自动机一次扫描匹配，正则逐条匹配；匹配前文本统一规范化，
+// 防止用空格、符号、全角字符或大小写绕过 (如「加 V-X」)
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Action 命中规则后的处理方式
+type Action string
+
+const (
+	ActionMask  Action = "mask"  // 命中部分替换为 *，内容照常发布
+	ActionFlag  Action = "flag"  // 内容照常发布，进入人工审核队列
+	ActionBlock Action = "block" // 拒绝发布
+)
+
+// Valid 是否为支持的处理方式
+func (a Action) Valid() bool {
+	return a == ActionMask || a == ActionFlag || a == ActionBlock
+}
+
+// Rule 一条过滤规则
+type Rule struct {
+	ID      uint
+	Pattern string
+	Regex   bool // Pattern 是正则表达式 (匹配规范化后的文本)
+	Action  Action
+}
+
+// Hit 一次命中
+type Hit struct {
+	RuleID uint   `json:"rule_id"`
+	Action Action `json:"action"`
+	Text   string `json:"text"` // 原文中命中的片段
+}
+
+// Result 检查结果
+type Result struct {
+	Original string // 检查的原文
+	Text     string // 屏蔽 (mask) 之后的文本
+	Hits     []Hit
+	Blocked  bool
+	Flagged  bool
+}
+
+// Words 命中的原文片段 (去重)，用于提示和审核记录
+func (r *Result) Words(action Action) []string {
+	seen := map[string]bool{}
+	words := []string{}
+	for _, h := range r.Hits {
+		if (action == "" || h.Action == action) && !seen[h.Text] {
+			seen[h.Text] = true
+			words = append(words, h.Text)
+		}
+	}
+	return words
+}
+
+// Filter 由一组规则编译出的过滤器，构建后只读，可并发使用
+type Filter struct {
+	words   []Rule // 关键词规则，下标与自动机中的模式对应
+	regexes []compiledRegex
+	ac      *matcher
+}
+
+type compiledRegex struct {
+	rule Rule
+	re   *regexp.Regexp
+}
+
+// Validate 检查单条规则能否编译 (管理后台保存规则前调用)
+func Validate(r Rule) error {
+	if !r.Action.Valid() {
+		return fmt.Errorf("不支持的处理方式: %s", r.Action)
+	}
+	if r.Regex {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("正则表达式无效: %v", err)
+		}
+		return nil
+	}
+	if len(normalize(r.Pattern).runes) == 0 {
+		return fmt.Errorf("关键词不能为空")
+	}
+	return nil
+}
+
+// New 编译规则，任一规则无效时返回错误
+func New(rules []Rule) (*Filter, error) {
+	f := &Filter{}
+	var patterns [][]rune
+	for _, r := range rules {
+		if err := Validate(r); err != nil {
+			return nil, fmt.Errorf("规则 %d (%s): %v", r.ID, r.Pattern, err)
+		}
+		if r.Regex {
+			f.regexes = append(f.regexes, compiledRegex{rule: r, re: regexp.MustCompile(r.Pattern)})
+			continue
+		}
+		f.words = append(f.words, r)
+		patterns = append(patterns, normalize(r.Pattern).runes)
+	}
+	if len(patterns) > 0 {
+		f.ac = newMatcher(patterns)
+	}
+	return f, nil
+}
+
+// Check 检查文本：mask 规则命中的部分替换为 *，block / flag 规则命中时分别置 Blocked / Flagged
+func (f *Filter) Check(text string) *Result {
+	res := &Result{Original: text, Text: text}
+	if f == nil || text == "" {
+		return res
+	}
+	norm := normalize(text)
+
+	type span struct {
+		rule       Rule
+		start, end int // 规范化文本中的 rune 下标
+	}
+	var spans []span
+	if f.ac != nil {
+		f.ac.find(norm.runes, func(p, start, end int) {
+			spans = append(spans, span{f.words[p], start, end})
+		})
+	}
+	if len(f.regexes) > 0 {
+		s := string(norm.runes)
+		for _, cr := range f.regexes {
+			for _, loc := range cr.re.FindAllStringIndex(s, -1) {
+				if loc[0] == loc[1] {
+					continue
+				}
+				start := len([]rune(s[:loc[0]]))
+				spans = append(spans, span{cr.rule, start, start + len([]rune(s[loc[0]:loc[1]]))})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return res
+	}
+
+	// 命中片段映射回原文的字节区间
+	masked := make([]bool, len(text))
+	for _, sp := range spans {
+		from, to := norm.offsets[sp.start], norm.offsets[sp.end-1]+norm.sizes[sp.end-1]
+		res.Hits = append(res.Hits, Hit{RuleID: sp.rule.ID, Action: sp.rule.Action, Text: text[from:to]})
+		switch sp.rule.Action {
+		case ActionBlock:
+			res.Blocked = true
+		case ActionFlag:
+			res.Flagged = true
+		case ActionMask:
+			for i := from; i < to; i++ {
+				masked[i] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range text {
+		if masked[i] && !unicode.IsSpace(r) {
+			b.WriteByte('*')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	res.Text = b.String()
+	return res
+}
+
+// normalized 规范化后的文本，offsets / sizes 记录每个 rune 在原文中的字节位置和长度
+type normalized struct {
+	runes   []rune
+	offsets []int
+	sizes   []int
+}
+
+// normalize 转小写、全角转半角，去掉空白、标点和符号
+func normalize(text string) normalized {
+	var n normalized
+	for i, r := range text {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		if r == '　' {
+			r = ' '
+		} else if r >= '！' && r <= '～' {
+			r -= '！' - '!'
+		}
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		n.runes = append(n.runes, unicode.ToLower(r))
+		n.offsets = append(n.offsets, i)
+		n.sizes = append(n.sizes, size)
+	}
+	return n
+}
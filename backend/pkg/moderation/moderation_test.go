@@ -0,0 +1,176 @@
+package moderation
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newFilter(t *testing.T, rules ...Rule) *Filter {
+	t.Helper()
+	f, err := New(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// hitTexts 命中的原文片段，按规则 ID 排序
+func hitTexts(res *Result) []string {
+	hits := append([]Hit(nil), res.Hits...)
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].RuleID < hits[j].RuleID })
+	texts := make([]string, len(hits))
+	for i, h := range hits {
+		texts[i] = h.Text
+	}
+	return texts
+}
+
+func TestCheckOverlappingPatterns(t *testing.T) {
+	cases := []struct {
+		name   string
+		rules  []Rule
+		text   string
+		masked string
+		hits   []string
+	}{
+		{
+			name:   "两个 mask 词部分重叠，合并打码",
+			rules:  []Rule{{ID: 1, Pattern: "加微信", Action: ActionMask}, {ID: 2, Pattern: "微信号", Action: ActionMask}},
+			text:   "加微信号123",
+			masked: "****123",
+			hits:   []string{"加微信", "微信号"},
+		},
+		{
+			name:   "短词包含在长词中 (失败链上的输出)",
+			rules:  []Rule{{ID: 1, Pattern: "abcd", Action: ActionMask}, {ID: 2, Pattern: "bc", Action: ActionFlag}},
+			text:   "xabcdx",
+			masked: "x****x",
+			hits:   []string{"abcd", "bc"},
+		},
+		{
+			name:   "同一个词多次出现且首尾相接",
+			rules:  []Rule{{ID: 1, Pattern: "aa", Action: ActionMask}},
+			text:   "aaa",
+			masked: "***",
+			hits:   []string{"aa", "aa"},
+		},
+		{
+			name:   "关键词与正则命中同一段",
+			rules:  []Rule{{ID: 1, Pattern: "转账", Action: ActionFlag}, {ID: 2, Pattern: `转账\d+`, Regex: true, Action: ActionMask}},
+			text:   "先转账500",
+			masked: "先*****",
+			hits:   []string{"转账", "转账500"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := newFilter(t, tc.rules...).Check(tc.text)
+			if res.Text != tc.masked {
+				t.Fatalf("打码结果 %q, 期望 %q", res.Text, tc.masked)
+			}
+			if got := hitTexts(res); !reflect.DeepEqual(got, tc.hits) {
+				t.Fatalf("命中 %q, 期望 %q", got, tc.hits)
+			}
+		})
+	}
+}
+
+func TestCheckActions(t *testing.T) {
+	f := newFilter(t,
+		Rule{ID: 1, Pattern: "刷单", Action: ActionBlock},
+		Rule{ID: 2, Pattern: "私聊", Action: ActionFlag},
+		Rule{ID: 3, Pattern: "微信", Action: ActionMask},
+	)
+	res := f.Check("私聊加微信，刷单返利，刷 单")
+	if !res.Blocked || !res.Flagged {
+		t.Fatalf("Blocked=%v Flagged=%v, 期望都为 true", res.Blocked, res.Flagged)
+	}
+	if res.Text != "私聊加**，刷单返利，刷 单" {
+		t.Fatalf("只有 mask 规则打码，结果为 %q", res.Text)
+	}
+	if got := res.Words(ActionBlock); !reflect.DeepEqual(got, []string{"刷单", "刷 单"}) {
+		t.Fatalf("Words(block) = %q", got)
+	}
+
+	clean := f.Check("九成新，自提")
+	if clean.Blocked || clean.Flagged || len(clean.Hits) != 0 || clean.Text != "九成新，自提" {
+		t.Fatalf("未命中的文本被改动: %+v", clean)
+	}
+}
+
+func TestCheckFullWidthAndCase(t *testing.T) {
+	f := newFilter(t,
+		Rule{ID: 1, Pattern: "vx", Action: ActionMask},
+		Rule{ID: 2, Pattern: "加微信", Action: ActionMask},
+		Rule{ID: 3, Pattern: "WeiXin", Action: ActionBlock},
+	)
+	cases := []struct {
+		text, masked string
+		hit          string
+	}{
+		{"加ＶＸ：abc", "加**：abc", "ＶＸ"},
+		{"加Ｖ－Ｘ", "加***", "Ｖ－Ｘ"},
+		{"加　微　信", "*　*　*", "加　微　信"}, // 全角空格保留
+		{"v.X123", "***123", "v.X"},
+	}
+	for _, tc := range cases {
+		res := f.Check(tc.text)
+		if res.Text != tc.masked {
+			t.Fatalf("%q: 打码结果 %q, 期望 %q", tc.text, res.Text, tc.masked)
+		}
+		if got := hitTexts(res); !reflect.DeepEqual(got, []string{tc.hit}) {
+			t.Fatalf("%q: 命中 %q, 期望 %q", tc.text, got, tc.hit)
+		}
+	}
+
+	if res := f.Check("ＷＥＩ　ｘｉｎ"); !res.Blocked || res.Words(ActionBlock)[0] != "ＷＥＩ　ｘｉｎ" {
+		t.Fatalf("全角大写没有命中 block 规则: %+v", res)
+	}
+}
+
+func TestCheckMaskOffsets(t *testing.T) {
+	f := newFilter(t,
+		Rule{ID: 1, Pattern: `\d{11}`, Regex: true, Action: ActionMask},
+		Rule{ID: 2, Pattern: "qq", Action: ActionMask},
+	)
+	cases := []struct{ text, masked, hit string }{
+		// 全角数字 (3 字节) 与半角数字混排，中间的空格不打码
+		{"电话：１３８ 0013 ８０００，谢谢", "电话：*** **** ****，谢谢", "１３８ 0013 ８０００"},
+		// 命中片段内部的符号一起打码，前后的多字节字符不受影响
+		{"联系q-q号", "联系***号", "q-q"},
+		{"qq", "**", "qq"},
+		{"😀Ｑｑ😀", "😀**😀", "Ｑｑ"},
+	}
+	for _, tc := range cases {
+		res := f.Check(tc.text)
+		if res.Text != tc.masked {
+			t.Fatalf("%q: 打码结果 %q, 期望 %q", tc.text, res.Text, tc.masked)
+		}
+		if len(res.Hits) != 1 || res.Hits[0].Text != tc.hit {
+			t.Fatalf("%q: 命中 %+v, 期望 %q", tc.text, res.Hits, tc.hit)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, r := range []Rule{
+		{Pattern: "词", Action: "delete"},
+		{Pattern: "(", Regex: true, Action: ActionMask},
+		{Pattern: " ，。", Action: ActionMask},
+	} {
+		if err := Validate(r); err == nil {
+			t.Fatalf("规则 %+v 应当无效", r)
+		}
+	}
+	if _, err := New([]Rule{{ID: 1, Pattern: "", Action: ActionMask}}); err == nil {
+		t.Fatal("New 接受了空关键词")
+	}
+}
+
+func TestNilFilter(t *testing.T) {
+	var f *Filter
+	if res := f.Check("任何内容"); res.Text != "任何内容" || len(res.Hits) != 0 {
+		t.Fatalf("未加载规则时内容被改动: %+v", res)
+	}
+}
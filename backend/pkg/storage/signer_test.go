@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// splitSigned 拆出签名链接的路径、expires 和 sig
+func splitSigned(t *testing.T, signed string) (string, string, string) {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Path, u.Query().Get("expires"), u.Query().Get("sig")
+}
+
+func TestSignerVerify(t *testing.T) {
+	s := &Signer{Secret: []byte("secret"), TTL: time.Hour}
+	path, expires, sig := splitSigned(t, s.Sign("/private/a.jpg"))
+
+	remaining, err := s.Verify(path, expires, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining <= 59*time.Minute || remaining > time.Hour {
+		t.Fatalf("剩余有效期 %v, 期望约 1 小时", remaining)
+	}
+
+	later, _ := strconv.ParseInt(expires, 10, 64)
+	cases := map[string][3]string{
+		"篡改路径":    {"/private/b.jpg", expires, sig},
+		"延长过期时间":  {path, strconv.FormatInt(later+3600, 10), sig},
+		"篡改签名":    {path, expires, sig[:len(sig)-1] + "0"},
+		"缺少签名":    {path, expires, ""},
+		"过期时间非数字": {path, "tomorrow", sig},
+	}
+	if sig[len(sig)-1] == '0' {
+		cases["篡改签名"] = [3]string{path, expires, sig[:len(sig)-1] + "1"}
+	}
+	for name, c := range cases {
+		if _, err := s.Verify(c[0], c[1], c[2]); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("%s: Verify 返回 %v, 期望 ErrBadSignature", name, err)
+		}
+	}
+
+	// 其他密钥签发的链接无效
+	other := &Signer{Secret: []byte("other"), TTL: time.Hour}
+	if _, err := other.Verify(path, expires, sig); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("密钥不同: Verify 返回 %v, 期望 ErrBadSignature", err)
+	}
+}
+
+func TestSignerExpired(t *testing.T) {
+	s := &Signer{Secret: []byte("secret"), TTL: -time.Second}
+	path, expires, sig := splitSigned(t, s.Sign("/private/a.jpg"))
+	if _, err := s.Verify(path, expires, sig); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("过期链接: Verify 返回 %v, 期望 ErrBadSignature", err)
+	}
+}
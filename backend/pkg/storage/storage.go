@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("文件不存在")
+
+// ErrInvalidKey 对象 key 非法 (空、绝对路径或包含 ..)
+var ErrInvalidKey = errors.New("文件路径非法")
+
+// ObjectInfo 对象元信息
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage 上传文件存储后端
+// key 为相对路径 (如 1764357893105742100.jpg)，由调用方保证唯一
+type Storage interface {
+	// Put 写入对象，已存在时覆盖
+	Put(key string, data []byte, contentType string) error
+	// Get 读取对象，调用方负责关闭；本地驱动返回的 ReadCloser 同时实现 io.Seeker
+	Get(key string) (io.ReadCloser, *ObjectInfo, error)
+	// Delete 删除对象，对象不存在时不报错
+	Delete(key string) error
+	// URL 对象的公开访问地址，不依赖请求的域名；以 / 开头表示相对当前站点，由本服务的 /uploads/ 路由提供
+	URL(key string) string
+}
+
+// Config 存储配置
+type Config struct {
+	Driver string // local (默认) 或 s3
+
+	// 本地磁盘
+	LocalDir    string // 保存目录
+	LocalPrefix string // 访问地址前缀，默认 /uploads/，部署在 CDN / 反向代理后可配置为完整地址
+
+	// S3 兼容存储 (AWS S3 / MinIO 等，使用 path-style 访问)
+	S3Endpoint  string // 如 http://127.0.0.1:9000
+	S3Region    string // 默认 us-east-1
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PublicURL string // 对外访问地址前缀，为空时使用 endpoint/bucket/
+}
+
+// New 按配置创建存储驱动
+func New(cfg Config) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocal(cfg.LocalDir, cfg.LocalPrefix)
+	case "s3":
+		return NewS3(cfg)
+	}
+	return nil, errors.New("未知的存储驱动: " + cfg.Driver)
+}
+
+// cleanKey 规范化 key，拒绝跳出根目录的路径
+func cleanKey(key string) (string, error) {
+	key = strings.ReplaceAll(key, "\\", "/")
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	key = path.Clean(key)
+	if key == "." {
+		return "", ErrInvalidKey
+	}
+	return key, nil
+}
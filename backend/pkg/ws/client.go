@@ -1,9 +1,7 @@
 package ws
 
 import (
-	"encoding/json"
 	"gotest/config"
-	"gotest/internal/models"
 	"log"
 	"time"
 
@@ -11,35 +9,84 @@ import (
 )
 
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+
+	// 信封和 payload 中除消息内容以外的字段 (type、帧 ID、receiver_id 等) 预留的字节数
+	frameOverhead = 1024
 )
 
+// maxFrameSize 单帧上限，由消息内容的长度上限推算
+// 文字按字符数限制，JSON 中一个字符最多占 12 字节 (BMP 以外的字符转义为 \uXXXX\uXXXX 代理对，BMP 内为 6 字节)，
+// 否则长度合法的消息会在读取时就被断开连接
+func maxFrameSize() int64 {
+	content := config.Chat.MaxTextLength * 12
+	if n := config.Chat.MaxImageURLLen * 6; n > content {
+		content = n
+	}
+	return int64(content + frameOverhead)
+}
+
 // Client 代表一个 WebSocket 连接用户
 type Client struct {
 	Hub    *Hub
 	Conn   *websocket.Conn
-	Send   chan []byte
+	Send   chan *Frame
 	UserID uint
+
+	// 协议版本：1 为旧版前端，2 为 Envelope 协议
+	Version int
+
+	// 重连时前端确认收到的最后一条消息 ID，连接建立后补发此后的消息
+	SyncFrom uint
+
+	// 本连接的上行帧限流
+	limiter *rateLimiter
 }
 
-// 接收前端发来的消息格式
+// 上行帧的 payload 字段 (v1 前端直接发送这个结构)
+// Event 为空时是聊天消息；read 表示已读与 TargetID 的会话；ack 表示已收到 LastID 及之前的消息；
+// recall / delete 表示撤回 / 删除 MessageID
 type InputMessage struct {
+	Event      string `json:"event"`
 	ReceiverID uint   `json:"receiver_id"`
 	Content    string `json:"content"`
 	Type       int    `json:"type"` // 1:文字 2:图片
+	TargetID   uint   `json:"target_id"`
+	LastID     uint   `json:"last_id"`
+
+	// 所属会话；从商品详情页发起的第一条消息只带 product_id，由服务端创建会话
+	ConversationID uint `json:"conversation_id"`
+	ProductID      uint `json:"product_id"`
+
+	// 撤回 / 删除的消息
+	MessageID uint `json:"message_id"`
 }
 
-// ReadPump 循环读取前端发来的消息
+// Reply 只发给当前连接 (通过 Hub 投递，连接已断开时丢弃)
+func (c *Client) Reply(frame *Frame) {
+	c.Hub.Push <- &PushMessage{Client: c, Frame: frame}
+}
+
+// ReplyError 回复 error 帧
+func (c *Client) ReplyError(id string, err error) {
+	perr, ok := err.(*Error)
+	if !ok {
+		perr = NewError("internal", err.Error())
+	}
+	c.Reply(&Frame{Type: TypeError, ID: id, Payload: perr})
+}
+
+// ReadPump 循环读取前端发来的消息，解析为 Envelope 后交给对应的处理函数
 func (c *Client) ReadPump() {
 	defer func() {
 		c.Hub.Unregister <- c
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
+	c.limiter = newRateLimiter(config.Chat.ConnFramesPerSecond, config.Chat.ConnBurst)
+	c.Conn.SetReadLimit(maxFrameSize())
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
@@ -52,33 +99,18 @@ func (c *Client) ReadPump() {
 			break
 		}
 
-		// 1. 解析消息
-		var input InputMessage
-		if err := json.Unmarshal(message, &input); err != nil {
+		env, err := decodeEnvelope(message)
+		if err != nil {
 			log.Println("消息格式错误:", err)
+			c.ReplyError("", ErrBadFrame)
 			continue
 		}
-
-		// 2. 构造数据库模型
-		msgModel := models.Message{
-			SenderID:   c.UserID,
-			ReceiverID: input.ReceiverID,
-			Content:    input.Content,
-			Type:       input.Type,
-			// CreatedAt 由 GORM 自动生成
-		}
-
-		// 3. ★★★ 存入 SQLite 数据库 ★★★
-		if err := config.DB.Create(&msgModel).Error; err != nil {
-			log.Println("消息存库失败:", err)
+		// 超出频率的帧直接拒绝，不交给处理函数 (不查库、不落库)
+		if !c.limiter.allow() {
+			c.ReplyError(env.ID, ErrRateLimited)
 			continue
 		}
-
-		// 4. 构造要广播的数据 (带上 ID 和时间，回传给前端)
-		broadcastMsg, _ := json.Marshal(msgModel)
-
-		// 5. 发送给 Hub 进行转发
-		c.Hub.Broadcast <- broadcastMsg
+		c.dispatch(env)
 	}
 }
 
@@ -90,29 +122,23 @@ func (c *Client) WritePump() {
 		c.Conn.Close()
 	}()
 
+	// 先补发离线期间错过的消息
+	if frame := c.syncFrame(); frame != nil {
+		if !c.write(frame) {
+			return
+		}
+	}
+
 	for {
 		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		case frame, ok := <-c.Send:
 			if !ok {
 				// Hub 关闭了通道
+				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// 如果队列里还有消息，一次性写完
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.Send)
-			}
-
-			if err := w.Close(); err != nil {
+			if !c.write(frame) {
 				return
 			}
 
@@ -125,3 +151,14 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// write 按连接的协议版本编码并写出一帧，写失败时返回 false
+func (c *Client) write(frame *Frame) bool {
+	data, err := frame.encode(c.Version)
+	if err != nil {
+		log.Println("WS: 消息编码失败:", err)
+		return true
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.Conn.WriteMessage(websocket.TextMessage, data) == nil
+}
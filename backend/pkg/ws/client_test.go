@@ -0,0 +1,45 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"gotest/config"
+	"strings"
+	"testing"
+)
+
+// escapeAll 把每个字符都转义成 \uXXXX (BMP 以外的字符为代理对)，模拟只输出 ASCII 的 JSON 编码器
+func escapeAll(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > 0xFFFF {
+			r -= 0x10000
+			fmt.Fprintf(&b, `\u%04x\u%04x`, 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+		} else {
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+	return b.String()
+}
+
+func TestMaxFrameSizeFitsLongestMessage(t *testing.T) {
+	for _, ch := range []string{"好", "😀"} {
+		content := strings.Repeat(ch, config.Chat.MaxTextLength)
+		frame := `{"v":2,"type":"message","id":"` + strings.Repeat("f", 64) + `","payload":` +
+			`{"receiver_id":4294967295,"conversation_id":4294967295,"product_id":4294967295,"type":1,"content":"` + escapeAll(content) + `"}}`
+
+		// 确认构造的帧能被正常解析出原文
+		env, err := decodeEnvelope([]byte(frame))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var input InputMessage
+		if err := json.Unmarshal(env.Payload, &input); err != nil || input.Content != content {
+			t.Fatalf("帧解析失败: %v", err)
+		}
+
+		if int64(len(frame)) > maxFrameSize() {
+			t.Fatalf("%d 个 %q 全部转义后帧长 %d 字节，超过读取上限 %d", config.Chat.MaxTextLength, ch, len(frame), maxFrameSize())
+		}
+	}
+}
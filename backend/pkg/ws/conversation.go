@@ -0,0 +1,98 @@
+package ws
+
+import (
+	"errors"
+	"gotest/config"
+	"gotest/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrProductNotInConversation 关联的商品不存在，或不属于会话的任何一方
+var ErrProductNotInConversation = errors.New("商品不存在或与会话双方无关")
+
+// ResolveConversation 查找两人就某商品 (productID 为 0 表示普通私聊) 的会话，不存在时创建
+// 关联商品时要求商品属于其中一方 (买家咨询卖家)
+func ResolveConversation(tx *gorm.DB, userID, peerID, productID uint) (*models.Conversation, error) {
+	if productID > 0 {
+		var product models.Product
+		if err := tx.Select("id", "user_id").First(&product, productID).Error; err != nil ||
+			(product.UserID != userID && product.UserID != peerID) {
+			return nil, ErrProductNotInConversation
+		}
+	}
+
+	a, b := models.ConversationPair(userID, peerID)
+	conv := models.Conversation{UserAID: a, UserBID: b, ProductID: productID}
+	query := func() *gorm.DB {
+		return tx.Where("user_a_id = ? AND user_b_id = ? AND product_id = ?", a, b, productID)
+	}
+	if err := query().FirstOrCreate(&conv).Error; err != nil {
+		// 并发创建时唯一索引冲突，再查一次
+		if err := query().First(&conv).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &conv, nil
+}
+
+// conversationForMessage 消息所属的会话：带 conversation_id 时须为发送者参与、接收者为另一方的会话，
+// 否则按 (发送者, 接收者, product_id) 查找或创建
+func conversationForMessage(tx *gorm.DB, senderID, receiverID, conversationID, productID uint) (*models.Conversation, error) {
+	if conversationID == 0 {
+		return ResolveConversation(tx, senderID, receiverID, productID)
+	}
+	var conv models.Conversation
+	if err := tx.First(&conv, conversationID).Error; err != nil {
+		return nil, err
+	}
+	if !conv.Has(senderID) || conv.PeerOf(senderID) != receiverID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &conv, nil
+}
+
+// recordMessage 消息存库后更新会话的最后一条消息，并给接收者加一条未读
+func recordMessage(tx *gorm.DB, conv *models.Conversation, msg *models.Message) error {
+	updates := map[string]interface{}{
+		"last_message_id":   msg.ID,
+		"last_sender_id":    msg.SenderID,
+		"last_message_type": msg.Type,
+		"last_message":      msg.Content,
+		"last_message_at":   msg.CreatedAt,
+		"updated_at":        time.Now(),
+	}
+	if msg.ReceiverID != msg.SenderID {
+		col := conv.UnreadColumn(msg.ReceiverID)
+		updates[col] = gorm.Expr(col + " + 1")
+	}
+	return tx.Model(&models.Conversation{}).Where("id = ?", conv.ID).Updates(updates).Error
+}
+
+// markConversationsRead 清空 readerID 在与 peerID 的会话中的未读数，并把已读位置移到最后一条消息
+// conversationID 为 0 时处理两人之间的所有会话
+func markConversationsRead(readerID, peerID, conversationID uint) error {
+	a, b := models.ConversationPair(readerID, peerID)
+	probe := models.Conversation{UserAID: a, UserBID: b}
+	unreadCol, lastReadCol := probe.UnreadColumn(readerID), probe.LastReadColumn(readerID)
+
+	db := config.DB.Model(&models.Conversation{}).Where("user_a_id = ? AND user_b_id = ?", a, b)
+	if conversationID > 0 {
+		db = db.Where("id = ?", conversationID)
+	}
+	return db.Updates(map[string]interface{}{
+		unreadCol:   0,
+		lastReadCol: gorm.Expr("last_message_id"),
+	}).Error
+}
+
+// ConversationUnread 用户所有会话的未读总数
+func ConversationUnread(userID uint) int64 {
+	var total int64
+	config.DB.Model(&models.Conversation{}).
+		Where("user_a_id = ? OR user_b_id = ?", userID, userID).
+		Select("COALESCE(SUM(CASE WHEN user_a_id = ? THEN unread_a ELSE unread_b END), 0)", userID).
+		Scan(&total)
+	return total
+}
@@ -0,0 +1,320 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"gotest/config"
+	"gotest/internal/models"
+	"log"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// HandlerFunc 处理一种上行帧
+// 返回的错误以 error 帧回给客户端：*Error 保留错误码，其他错误统一为 internal
+type HandlerFunc func(c *Client, env *Envelope) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[string]HandlerFunc)
+)
+
+// Handle 注册某种帧类型的处理函数，重复注册会覆盖
+// 新增事件类型只需在这里注册，无需改动 ReadPump / WritePump
+func Handle(frameType string, h HandlerFunc) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[frameType] = h
+}
+
+// MessageFilter 聊天消息存库前的检查，可以修改消息 (如屏蔽敏感词)
+// 返回错误时拒绝发送，以 error 帧回给客户端
+type MessageFilter func(c *Client, msg *models.Message) error
+
+var messageFilters []MessageFilter
+
+// UseMessageFilter 注册消息检查，按注册顺序执行
+// 拉黑、内容审核等业务规则在 services 中实现后注册到这里，ws 包不依赖具体业务
+func UseMessageFilter(f MessageFilter) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	messageFilters = append(messageFilters, f)
+}
+
+// filterMessage 依次执行已注册的消息检查
+func filterMessage(c *Client, msg *models.Message) error {
+	handlersMu.RLock()
+	filters := messageFilters
+	handlersMu.RUnlock()
+	for _, f := range filters {
+		if err := f(c, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessageHook 聊天消息存库之后的回调 (如记录待审核的消息)，不影响发送结果
+// msg.Content 是检查后实际存库的内容，msg.OriginalContent 是发送者提交的原文
+type MessageHook func(msg *models.Message)
+
+var messageHooks []MessageHook
+
+// UseMessageHook 注册消息存库后的回调，按注册顺序执行
+func UseMessageHook(h MessageHook) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	messageHooks = append(messageHooks, h)
+}
+
+// afterMessage 依次执行已注册的存库后回调
+func afterMessage(msg *models.Message) {
+	handlersMu.RLock()
+	hooks := messageHooks
+	handlersMu.RUnlock()
+	for _, h := range hooks {
+		h(msg)
+	}
+}
+
+// dispatch 把上行帧交给对应的处理函数
+func (c *Client) dispatch(env *Envelope) {
+	handlersMu.RLock()
+	h, ok := handlers[env.Type]
+	handlersMu.RUnlock()
+	if !ok {
+		c.ReplyError(env.ID, ErrUnknownType)
+		return
+	}
+	if err := h(c, env); err != nil {
+		c.ReplyError(env.ID, err)
+	}
+}
+
+func init() {
+	Handle(TypeMessage, handleMessage)
+	Handle(TypeRead, handleRead)
+	Handle(TypeAck, handleAck)
+	Handle(TypeTyping, handleTyping)
+	Handle(TypePing, handlePing)
+	Handle(TypeRecall, handleRecall)
+	Handle(TypeDelete, handleDelete)
+}
+
+// decodePayload 解析帧内容，失败时返回 bad_frame
+func decodePayload(env *Envelope, v interface{}) error {
+	if len(env.Payload) == 0 || json.Unmarshal(env.Payload, v) != nil {
+		return ErrBadFrame
+	}
+	return nil
+}
+
+// handleMessage 发送聊天消息：存库后推送给双方所有设备，带帧 ID 时回 ack 带上消息 ID
+// 同一发送者重复提交相同的帧 ID 时不再重复存库，直接回 ack
+func handleMessage(c *Client, env *Envelope) error {
+	var input InputMessage
+	if err := decodePayload(env, &input); err != nil {
+		return err
+	}
+
+	if existing := findByClientMsgID(c.UserID, env.ID); existing != nil {
+		c.Reply(&Frame{Type: TypeAck, ID: env.ID, Payload: messageAck(existing)})
+		return nil
+	}
+
+	// 无效的消息和重发的消息 (上面已回 ack) 不计入限额
+	if err := validateMessage(c.UserID, &input); err != nil {
+		return err
+	}
+	if !allowUserMessage(c.UserID) {
+		return ErrRateLimited
+	}
+
+	// 构造数据库模型
+	msgModel := models.Message{
+		SenderID:    c.UserID,
+		ReceiverID:  input.ReceiverID,
+		Content:     input.Content,
+		Type:        input.Type,
+		ClientMsgID: env.ID,
+
+		OriginalContent: input.Content,
+		// CreatedAt 由 GORM 自动生成
+	}
+	if err := filterMessage(c, &msgModel); err != nil {
+		return err
+	}
+
+	// 存库到交给 Hub 之间持有会话锁，同一会话的消息按 ID 顺序发布到总线
+	lock := conversationLock(msgModel.SenderID, msgModel.ReceiverID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// ★★★ 存入 SQLite 数据库 ★★★ (消息和会话摘要在同一事务中更新)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		conv, err := conversationForMessage(tx, c.UserID, input.ReceiverID, input.ConversationID, input.ProductID)
+		if err != nil {
+			return err
+		}
+		msgModel.ConversationID = conv.ID
+		if err := tx.Create(&msgModel).Error; err != nil {
+			return err
+		}
+		return recordMessage(tx, conv, &msgModel)
+	})
+	switch {
+	case errors.Is(err, ErrProductNotInConversation):
+		return NewError("invalid_product", err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NewError("invalid_conversation", "会话不存在")
+	case err != nil:
+		// 同一帧 ID 并发重发时由唯一索引拦下，按重复消息回 ack
+		if existing := findByClientMsgID(c.UserID, env.ID); existing != nil {
+			c.Reply(&Frame{Type: TypeAck, ID: env.ID, Payload: messageAck(existing)})
+			return nil
+		}
+		log.Println("消息存库失败:", err)
+		return NewError("internal", "消息发送失败")
+	}
+	afterMessage(&msgModel)
+
+	// 旧版客户端不带帧 ID，无从匹配 ack，只靠广播回来的消息确认
+	if env.ID != "" {
+		c.Reply(&Frame{Type: TypeAck, ID: env.ID, Payload: messageAck(&msgModel)})
+	}
+
+	// 私有图片存的是 /private/xxx 引用，推送给双方时换成临时签名链接
+	if msgModel.Type == 2 {
+		msgModel.Content = config.SignedURL(msgModel.Content)
+	}
+	// 发送给 Hub 进行转发
+	c.Hub.Broadcast <- &msgModel
+	return nil
+}
+
+// findByClientMsgID 查找发送者已用该帧 ID 发出的消息，没有帧 ID 或未发过时返回 nil
+// (sender_id, client_msg_id) 有唯一索引，同一帧 ID 最多存一条
+func findByClientMsgID(senderID uint, clientMsgID string) *models.Message {
+	if clientMsgID == "" {
+		return nil
+	}
+	var existing models.Message
+	if err := config.DB.Unscoped().Where("sender_id = ? AND client_msg_id = ?", senderID, clientMsgID).First(&existing).Error; err != nil {
+		return nil
+	}
+	return &existing
+}
+
+// conversationLocks 按会话分片的锁 (两人之间的会话固定落在同一把锁上)
+var conversationLocks [64]sync.Mutex
+
+func conversationLock(a, b uint) *sync.Mutex {
+	if a > b {
+		a, b = b, a
+	}
+	return &conversationLocks[(uint64(a)*31+uint64(b))%uint64(len(conversationLocks))]
+}
+
+func messageAck(m *models.Message) map[string]interface{} {
+	return map[string]interface{}{"message_id": m.ID, "created_at": m.CreatedAt}
+}
+
+// handleRead 会话已读 (payload: {"target_id", "conversation_id"})，不带 conversation_id 时标记与对方的所有会话
+func handleRead(c *Client, env *Envelope) error {
+	var input InputMessage
+	if err := decodePayload(env, &input); err != nil {
+		return err
+	}
+	if input.TargetID == 0 {
+		return NewError("invalid_target", "缺少会话对象")
+	}
+	receipt, err := c.Hub.MarkConversationRead(c.UserID, input.TargetID, input.ConversationID)
+	if err != nil {
+		log.Println("标记已读失败:", err)
+		return NewError("internal", "标记已读失败")
+	}
+	if env.ID != "" {
+		c.Reply(&Frame{Type: TypeAck, ID: env.ID, Payload: receipt})
+	}
+	return nil
+}
+
+// handleAck 客户端确认已收到的最大消息 ID (payload: {"last_id"})
+func handleAck(c *Client, env *Envelope) error {
+	var input InputMessage
+	if err := decodePayload(env, &input); err != nil {
+		return err
+	}
+	AckMessages(c.UserID, input.LastID)
+	return nil
+}
+
+// handleTyping 正在输入提示，转发给对方 (payload: {"target_id"})，不存库
+// 与聊天消息走同样的检查 (拉黑、隐私设置)，不能发消息时直接丢弃，不为每次输入回 error 帧
+func handleTyping(c *Client, env *Envelope) error {
+	var input InputMessage
+	if err := decodePayload(env, &input); err != nil {
+		return err
+	}
+	if input.TargetID == 0 {
+		return NewError("invalid_target", "缺少会话对象")
+	}
+	if err := filterMessage(c, &models.Message{SenderID: c.UserID, ReceiverID: input.TargetID}); err != nil {
+		return nil
+	}
+	c.Hub.PushToUser(input.TargetID, TypeTyping, map[string]interface{}{"from": c.UserID})
+	return nil
+}
+
+// handleRecall 撤回自己发送的消息 (payload: {"message_id"})
+func handleRecall(c *Client, env *Envelope) error {
+	var input InputMessage
+	if err := decodePayload(env, &input); err != nil {
+		return err
+	}
+	notice, err := c.Hub.RecallMessage(c.UserID, input.MessageID)
+	if err != nil {
+		return messageOpError(err)
+	}
+	if env.ID != "" {
+		c.Reply(&Frame{Type: TypeAck, ID: env.ID, Payload: notice})
+	}
+	return nil
+}
+
+// handleDelete 从自己的聊天记录中删除消息 (payload: {"message_id"})
+func handleDelete(c *Client, env *Envelope) error {
+	var input InputMessage
+	if err := decodePayload(env, &input); err != nil {
+		return err
+	}
+	notice, err := c.Hub.DeleteMessageForUser(c.UserID, input.MessageID)
+	if err != nil {
+		return messageOpError(err)
+	}
+	if env.ID != "" {
+		c.Reply(&Frame{Type: TypeAck, ID: env.ID, Payload: notice})
+	}
+	return nil
+}
+
+// messageOpError 撤回 / 删除失败的错误码
+func messageOpError(err error) error {
+	switch {
+	case errors.Is(err, ErrMessageNotFound):
+		return NewError("message_not_found", err.Error())
+	case errors.Is(err, ErrNotSender):
+		return NewError("not_sender", err.Error())
+	case errors.Is(err, ErrRecallExpired):
+		return NewError("recall_expired", err.Error())
+	}
+	log.Println("消息操作失败:", err)
+	return NewError("internal", "操作失败")
+}
+
+// handlePing 应用层心跳
+func handlePing(c *Client, env *Envelope) error {
+	c.Reply(&Frame{Type: TypePong, ID: env.ID})
+	return nil
+}
@@ -3,92 +3,340 @@ package ws
 import (
 	"encoding/json"
 	"gotest/internal/models"
+	"gotest/pkg/broker"
 	"log"
+	"sync"
+	"time"
 )
 
-// Hub 维护所有活跃连接并广播消息
+// chatTopic 聊天消息和推送在消息总线上的主题
+const chatTopic = "chat"
+
+// Hub 维护本实例的活跃连接并广播消息
 // 注意：Client 结构体定义在同包下的 client.go 文件中，这里不需要重复定义
+// 多实例部署时，发给用户的消息先发布到 Broker，再由每个实例推送给连在自己上面的设备
 type Hub struct {
 	// 注册的客户端 map[Client指针]bool
 	Clients map[*Client]bool
 
-	// 用户索引 map[UserID]Client指针
-	// 用于通过 UserID 快速找到对应的连接，实现点对点发消息
-	UserClients map[uint]*Client
+	// 用户索引 map[UserID]该用户的所有连接
+	// 同一用户可以同时在手机、电脑等多个设备上在线，消息会推送到每个设备
+	UserClients map[uint]map[*Client]bool
+
+	// 保护 Clients / UserClients：写操作只在 Run 中进行，OnlineDevices 等方法可在其他 goroutine 中读
+	mu sync.RWMutex
 
-	// 广播通道：接收来自 Client 的 []byte 消息
-	Broadcast chan []byte
+	// 广播通道：接收已存库的聊天消息，推送给收发双方
+	Broadcast chan *models.Message
 
 	// 注册通道
 	Register chan *Client
 
 	// 注销通道
 	Unregister chan *Client
+
+	// 定向推送通道：服务端主动推给某个用户 (如系统通知)
+	Push chan *PushMessage
+
+	// 跨实例消息总线和在线状态
+	Broker broker.Broker
+
+	// 从 Broker 收到的推送，交给 Run 投递给本实例的连接
+	remote chan *fanout
+
+	// 总线断线重连后通知 Run 补发；lastMessageID 为断线前从总线收到的最大消息 ID (只在 Run 中读写)
+	resumed       chan struct{}
+	lastMessageID uint
+}
+
+// fanout 通过 Broker 在实例间转发的推送
+type fanout struct {
+	UserIDs []uint          `json:"user_ids"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// PushMessage 发给指定用户 (所有设备) 或指定连接的服务端消息
+type PushMessage struct {
+	UserID uint
+	Client *Client // 不为空时只发给这个连接
+	Frame  *Frame
 }
 
-// NewHub 初始化 Hub
-func NewHub() *Hub {
+// PushToUser 将任意事件推送给指定用户的所有设备 (用户不在线时直接丢弃)
+// 按各连接的协议版本编码：v2 为 Envelope，v1 为 {"event": 事件名, "data": 数据}
+// 推送是尽力而为的：Push 队列已满时丢弃并记录日志，不阻塞调用方
+func (h *Hub) PushToUser(userID uint, event string, data interface{}) {
+	select {
+	case h.Push <- &PushMessage{UserID: userID, Frame: &Frame{Type: event, Payload: data}}:
+	default:
+		log.Printf("WS: 推送队列已满，丢弃发给用户 %d 的 %s 事件", userID, event)
+	}
+}
+
+// NewHub 初始化 Hub，b 为 nil 时使用进程内总线 (单实例)
+func NewHub(b broker.Broker) *Hub {
+	if b == nil {
+		b = broker.NewMemory("local")
+	}
 	return &Hub{
-		Broadcast:   make(chan []byte),
+		Broadcast:   make(chan *models.Message),
 		Register:    make(chan *Client),
 		Unregister:  make(chan *Client),
+		Push:        make(chan *PushMessage, 256),
 		Clients:     make(map[*Client]bool),
-		UserClients: make(map[uint]*Client),
+		UserClients: make(map[uint]map[*Client]bool),
+		Broker:      b,
+		remote:      make(chan *fanout, 1024),
+		resumed:     make(chan struct{}, 1),
+	}
+}
+
+// OnlineDevices 用户当前在所有实例上在线的设备 (连接) 数，0 表示离线
+// 总线不可用时只统计本实例
+func (h *Hub) OnlineDevices(userID uint) int {
+	if n, err := h.Broker.Devices(userID); err == nil {
+		return n
 	}
+	return h.localDevices(userID)
+}
+
+// OnlineDevicesOf 批量查询多个用户的在线设备数，离线用户不在结果中
+// 总线不可用时只统计本实例
+func (h *Hub) OnlineDevicesOf(userIDs []uint) map[uint]int {
+	if devices, err := h.Broker.DevicesOf(userIDs); err == nil {
+		return devices
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	devices := make(map[uint]int, len(userIDs))
+	for _, id := range userIDs {
+		if n := len(h.UserClients[id]); n > 0 {
+			devices[id] = n
+		}
+	}
+	return devices
+}
+
+// localDevices 用户连在本实例上的设备数
+func (h *Hub) localDevices(userID uint) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.UserClients[userID])
+}
+
+// updatePresence 把本实例上的设备数同步到总线
+func (h *Hub) updatePresence(userID uint) {
+	if err := h.Broker.SetPresence(userID, h.localDevices(userID)); err != nil {
+		log.Println("WS: 更新在线状态失败:", err)
+	}
+}
+
+// IsOnline 用户是否至少有一个设备在线
+func (h *Hub) IsOnline(userID uint) bool {
+	return h.OnlineDevices(userID) > 0
+}
+
+// addClient 登记连接
+func (h *Hub) addClient(client *Client) {
+	h.mu.Lock()
+	h.Clients[client] = true
+	if h.UserClients[client.UserID] == nil {
+		h.UserClients[client.UserID] = make(map[*Client]bool)
+	}
+	h.UserClients[client.UserID][client] = true
+	h.mu.Unlock()
+	h.updatePresence(client.UserID)
+}
+
+// removeClient 移除连接并关闭其发送通道；只移除这一个连接，同一用户的其他设备不受影响
+// 重复移除 (如发送阻塞已被清理后又收到注销) 时直接忽略
+func (h *Hub) removeClient(client *Client) bool {
+	h.mu.Lock()
+	if _, ok := h.Clients[client]; !ok {
+		h.mu.Unlock()
+		return false
+	}
+	delete(h.Clients, client)
+	if devices := h.UserClients[client.UserID]; devices != nil {
+		delete(devices, client)
+		if len(devices) == 0 {
+			delete(h.UserClients, client.UserID)
+		}
+	}
+	close(client.Send) // 关闭通道，通知 WritePump 退出
+	h.mu.Unlock()
+	h.updatePresence(client.UserID)
+	return true
+}
+
+// publish 把推送发布到总线，由各实例 (包括本实例) 投递给这些用户的设备
+// 总线不可用时退化为只投递本实例的连接
+func (h *Hub) publish(userIDs []uint, frame *Frame) {
+	payload, err := json.Marshal(frame.Payload)
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(&fanout{UserIDs: userIDs, Type: frame.Type, Payload: payload})
+		if err == nil {
+			err = h.Broker.Publish(chatTopic, data)
+		}
+	}
+	if err != nil {
+		log.Println("WS: 发布到消息总线失败，只推送本实例:", err)
+		for _, id := range userIDs {
+			h.sendToUser(id, frame)
+		}
+	}
+}
+
+// sendToUser 把消息发给用户的所有设备；发送阻塞 (对方掉线或卡死) 的连接会被清理
+func (h *Hub) sendToUser(userID uint, frame *Frame) {
+	h.mu.RLock()
+	devices := make([]*Client, 0, len(h.UserClients[userID]))
+	for client := range h.UserClients[userID] {
+		devices = append(devices, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range devices {
+		select {
+		case client.Send <- frame:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+// sendToClient 只发给指定连接 (连接已注销时丢弃)
+func (h *Hub) sendToClient(client *Client, frame *Frame) {
+	h.mu.RLock()
+	_, ok := h.Clients[client]
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+	select {
+	case client.Send <- frame:
+	default:
+		h.removeClient(client)
+	}
+}
+
+// Subscribe 订阅消息总线，需在 Run 之前调用
+// 订阅失败时按 1s、2s、4s... 退避重试，仍然失败返回错误：没有订阅就收不到任何推送 (包括本实例发布的)，不能带病启动
+func (h *Hub) Subscribe() error {
+	// 总线按发布顺序回调，经 remote 通道交给主循环，保证投递顺序不变
+	handler := func(data []byte) {
+		var ev fanout
+		if err := json.Unmarshal(data, &ev); err != nil {
+			log.Println("WS: 总线消息解析失败:", err)
+			return
+		}
+		h.remote <- &ev
+	}
+	resumed := func() {
+		select {
+		case h.resumed <- struct{}{}:
+		default: // 已有一次待处理的补发
+		}
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := h.Broker.Subscribe(chatTopic, handler, resumed)
+		if err == nil {
+			return nil
+		}
+		if attempt == subscribeAttempts {
+			return err
+		}
+		log.Printf("WS: 订阅消息总线失败 (第 %d 次)，%v 后重试: %v", attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// subscribeAttempts 启动时订阅消息总线的最大尝试次数
+const subscribeAttempts = 5
+
+// resync 总线重新订阅后，给本实例的每个连接补发断线期间可能错过的聊天消息
+// 断线前收到过消息时从该消息之后补发 (重新订阅后又从总线收到的消息会重复，前端按消息 ID 去重)，
+// 否则按连接建立时的同步位置补发；已读回执、撤回等其他事件无法补发，前端刷新会话时会重新拉取
+func (h *Hub) resync() {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.Clients))
+	for client := range h.Clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	from := h.lastMessageID
+	go func() {
+		for _, client := range clients {
+			var frame *Frame
+			if from > 0 {
+				frame = syncFrameAfter(client.UserID, from)
+			} else {
+				frame = client.syncFrame()
+			}
+			if frame != nil {
+				h.Push <- &PushMessage{Client: client, Frame: frame}
+			}
+		}
+	}()
 }
 
 // Run 启动 Hub 的主循环 (在一个单独的 goroutine 中运行)
 func (h *Hub) Run() {
 	for {
 		select {
-		// 1. 处理用户上线
+		// 1. 处理设备上线
 		case client := <-h.Register:
-			h.Clients[client] = true
-			h.UserClients[client.UserID] = client
-			log.Printf("WS: 用户 %d 上线", client.UserID)
+			h.addClient(client)
+			log.Printf("WS: 用户 %d 上线 (本实例在线设备 %d)", client.UserID, h.localDevices(client.UserID))
 
-		// 2. 处理用户下线
+		// 2. 处理设备下线
 		case client := <-h.Unregister:
-			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				delete(h.UserClients, client.UserID)
-				close(client.Send) // 关闭通道，通知 WritePump 退出
-				log.Printf("WS: 用户 %d 下线", client.UserID)
+			if h.removeClient(client) {
+				log.Printf("WS: 用户 %d 的一个设备下线 (本实例剩余在线设备 %d)", client.UserID, h.localDevices(client.UserID))
 			}
 
-		// 3. 处理消息转发
-		case message := <-h.Broadcast:
-			// 这里收到的 message 已经是 client.go 存入数据库后发来的 JSON 字节流
-			// 我们需要解析它，看看是发给谁的
-			var msgModel models.Message
-			if err := json.Unmarshal(message, &msgModel); err != nil {
-				log.Println("WS: 广播消息解析失败:", err)
-				continue
+		// 3. 处理定向推送
+		case push := <-h.Push:
+			if push.Client != nil {
+				h.sendToClient(push.Client, push.Frame)
+			} else {
+				h.publish([]uint{push.UserID}, push.Frame)
 			}
 
-			// A. 发送给接收者 (如果在线)
-			if receiver, ok := h.UserClients[msgModel.ReceiverID]; ok {
-				select {
-				case receiver.Send <- message:
-				default:
-					// 如果发送阻塞（对方掉线或卡死），清理连接
-					close(receiver.Send)
-					delete(h.Clients, receiver)
-					delete(h.UserClients, receiver.UserID)
-				}
+		// 4. 处理消息转发：发布给接收者和发送者的所有设备 (可能连在其他实例上)
+		// 发回给发送者是为了支持“多端同步”，或者让前端确认消息已发送成功
+		case msg := <-h.Broadcast:
+			userIDs := []uint{msg.ReceiverID}
+			if msg.SenderID != msg.ReceiverID {
+				userIDs = append(userIDs, msg.SenderID)
 			}
+			h.publish(userIDs, &Frame{Type: TypeMessage, Payload: msg})
 
-			// B. 发回给发送者 (如果在线)
-			// 这一步是为了支持“多端同步”，或者让前端确认消息已发送成功
-			if sender, ok := h.UserClients[msgModel.SenderID]; ok {
-				select {
-				case sender.Send <- message:
-				default:
-					close(sender.Send)
-					delete(h.Clients, sender)
-					delete(h.UserClients, sender.UserID)
+		// 5. 投递总线上的推送给本实例的连接
+		case ev := <-h.remote:
+			if ev.Type == TypeMessage {
+				var msg struct {
+					ID uint `json:"id"`
+				}
+				if json.Unmarshal(ev.Payload, &msg) == nil && msg.ID > h.lastMessageID {
+					h.lastMessageID = msg.ID
 				}
 			}
+			frame := &Frame{Type: ev.Type, Payload: ev.Payload}
+			for _, id := range ev.UserIDs {
+				h.sendToUser(id, frame)
+			}
+
+		// 6. 总线断线重连，补发断线期间的消息
+		case <-h.resumed:
+			log.Println("WS: 消息总线已恢复，为本实例的连接补发消息")
+			h.resync()
 		}
 	}
 }
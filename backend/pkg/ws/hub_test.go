@@ -0,0 +1,215 @@
+package ws
+
+import (
+	"encoding/json"
+	"gotest/internal/models"
+	"gotest/pkg/broker"
+	"testing"
+	"time"
+)
+
+// newTestHub 启动一个使用进程内总线的 Hub
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	b := broker.NewMemory("test")
+	t.Cleanup(func() { b.Close() })
+	h := NewHub(b)
+	if err := h.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+	go h.Run()
+	return h
+}
+
+// connect 注册一个不带真实连接的设备，只用 Send 通道收消息
+func connect(h *Hub, userID uint) *Client {
+	c := &Client{Hub: h, UserID: userID, Send: make(chan *Frame, 16), Version: ProtocolVersion}
+	h.Register <- c
+	return c
+}
+
+// waitFor 等待 Run 处理完之前发出的注册 / 注销
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// receive 从设备收一帧，超时则失败
+func receive(t *testing.T, c *Client) *Frame {
+	t.Helper()
+	select {
+	case f, ok := <-c.Send:
+		if !ok {
+			t.Fatalf("用户 %d 的设备已被关闭", c.UserID)
+		}
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatalf("用户 %d 的设备没有收到消息", c.UserID)
+	}
+	return nil
+}
+
+// assertClosed 已注销设备的发送通道应被关闭
+func assertClosed(t *testing.T, c *Client) {
+	t.Helper()
+	select {
+	case _, ok := <-c.Send:
+		if ok {
+			t.Fatalf("已注销的设备仍收到消息")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("已注销设备的发送通道没有关闭")
+	}
+}
+
+func TestHubUnregisterOneDeviceKeepsOther(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		first bool // true: 注销先连上的设备 A；false: 注销后连上的设备 B
+	}{
+		{"注销先连接的设备", true},
+		{"注销后连接的设备", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTestHub(t)
+			a := connect(h, 1)
+			b := connect(h, 1)
+			waitFor(t, "两个设备上线", func() bool { return h.OnlineDevices(1) == 2 })
+
+			gone, kept := a, b
+			if !tc.first {
+				gone, kept = b, a
+			}
+			h.Unregister <- gone
+			waitFor(t, "一个设备下线", func() bool { return h.OnlineDevices(1) == 1 })
+			assertClosed(t, gone)
+
+			h.PushToUser(1, TypeNotification, "hello")
+			if f := receive(t, kept); f.Type != TypeNotification {
+				t.Fatalf("收到的帧类型为 %q", f.Type)
+			}
+			if n := h.OnlineDevices(1); n != 1 {
+				t.Fatalf("OnlineDevices = %d, 期望 1", n)
+			}
+		})
+	}
+}
+
+func TestHubUnregisterTwice(t *testing.T) {
+	h := newTestHub(t)
+	a := connect(h, 1)
+	b := connect(h, 1)
+	waitFor(t, "两个设备上线", func() bool { return h.OnlineDevices(1) == 2 })
+
+	// 重复注销不能重复关闭通道，也不能影响同一用户的其他设备
+	h.Unregister <- a
+	h.Unregister <- a
+	waitFor(t, "一个设备下线", func() bool { return h.OnlineDevices(1) == 1 })
+
+	h.PushToUser(1, TypeNotification, "hello")
+	receive(t, b)
+	if n := h.OnlineDevices(1); n != 1 {
+		t.Fatalf("OnlineDevices = %d, 期望 1", n)
+	}
+
+	h.Unregister <- b
+	h.Unregister <- b
+	waitFor(t, "全部下线", func() bool { return h.OnlineDevices(1) == 0 })
+	if h.IsOnline(1) {
+		t.Fatalf("所有设备注销后仍显示在线")
+	}
+}
+
+func TestHubMessageReachesSenderOtherDevices(t *testing.T) {
+	h := newTestHub(t)
+	phone := connect(h, 1)
+	desktop := connect(h, 1)
+	peer := connect(h, 2)
+	waitFor(t, "设备上线", func() bool { return h.OnlineDevices(1) == 2 && h.OnlineDevices(2) == 1 })
+
+	// 从手机发出的消息，电脑上也要同步显示
+	h.Broadcast <- &models.Message{ID: 7, SenderID: 1, ReceiverID: 2, Content: "在吗", Type: 1}
+
+	for _, c := range []*Client{phone, desktop, peer} {
+		f := receive(t, c)
+		if f.Type != TypeMessage {
+			t.Fatalf("用户 %d 收到的帧类型为 %q", c.UserID, f.Type)
+		}
+		raw, _ := json.Marshal(f.Payload)
+		var msg models.Message
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatalf("解析消息失败: %v", err)
+		}
+		if msg.ID != 7 || msg.Content != "在吗" {
+			t.Fatalf("用户 %d 收到的消息不对: %+v", c.UserID, msg)
+		}
+	}
+}
+
+func TestPushToUserDoesNotBlockWhenQueueFull(t *testing.T) {
+	// 不启动 Run，Push 队列不会被消费
+	h := NewHub(broker.NewMemory("test"))
+	defer h.Broker.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(h.Push)+10; i++ {
+			h.PushToUser(1, TypeNotification, i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Push 队列已满时 PushToUser 被阻塞")
+	}
+	if len(h.Push) != cap(h.Push) {
+		t.Fatalf("队列中有 %d 条推送，期望 %d", len(h.Push), cap(h.Push))
+	}
+}
+
+func TestTypingRespectsMessageFilters(t *testing.T) {
+	h := newTestHub(t)
+	sender := connect(h, 1)
+	friend := connect(h, 2)
+	blocker := connect(h, 3)
+	waitFor(t, "设备上线", func() bool { return h.OnlineDevices(1)+h.OnlineDevices(2)+h.OnlineDevices(3) == 3 })
+
+	// 用户 3 拉黑了用户 1
+	handlersMu.Lock()
+	saved := messageFilters
+	messageFilters = []MessageFilter{func(c *Client, msg *models.Message) error {
+		if msg.ReceiverID == 3 {
+			return NewError("blocked", "对方已将你拉黑")
+		}
+		return nil
+	}}
+	handlersMu.Unlock()
+	t.Cleanup(func() {
+		handlersMu.Lock()
+		messageFilters = saved
+		handlersMu.Unlock()
+	})
+
+	for _, target := range []string{"3", "2"} {
+		env := &Envelope{Type: TypeTyping, Payload: json.RawMessage(`{"target_id":` + target + `}`)}
+		if err := handleTyping(sender, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f := receive(t, friend); f.Type != TypeTyping {
+		t.Fatalf("收到的帧类型为 %q", f.Type)
+	}
+	// 给用户 2 的提示已送达，发给用户 3 的更早，没有收到说明被丢弃了
+	select {
+	case f := <-blocker.Send:
+		t.Fatalf("拉黑了发送者的用户收到了输入提示: %+v", f)
+	default:
+	}
+}
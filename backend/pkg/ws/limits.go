@@ -0,0 +1,146 @@
+package ws
+
+import (
+	"gotest/config"
+	"gotest/internal/models"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrRateLimited     = NewError("rate_limited", "发送太频繁，请稍后再试")
+	ErrContentTooLong  = NewError("content_too_long", "消息内容过长")
+	ErrInvalidImage    = NewError("invalid_image", "图片地址无效，请重新上传")
+	ErrInvalidReceiver = NewError("invalid_receiver", "接收者不存在")
+)
+
+// rateLimiter 令牌桶：每秒补充 rate 个令牌，最多攒 burst 个；rate 为 0 时不限流
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow 取一个令牌，没有可用令牌时返回 false
+func (l *rateLimiter) allow() bool {
+	if l == nil || l.rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// idle 令牌已经攒满 (长时间没有发送)，可以回收
+func (l *rateLimiter) idle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens+time.Since(l.last).Seconds()*l.rate >= l.burst
+}
+
+// 按用户限流 (同一用户的所有设备共用)；多实例部署时各实例分别计数
+var userLimiters = struct {
+	sync.Mutex
+	m         map[uint]*rateLimiter
+	lastSweep time.Time
+}{m: make(map[uint]*rateLimiter)}
+
+// allowUserMessage 用户发送聊天消息是否在限额内
+func allowUserMessage(userID uint) bool {
+	rate := config.Chat.UserMessagesPerMinute / 60
+	if rate <= 0 {
+		return true
+	}
+
+	userLimiters.Lock()
+	if time.Since(userLimiters.lastSweep) > time.Minute {
+		for id, l := range userLimiters.m {
+			if l.idle() {
+				delete(userLimiters.m, id)
+			}
+		}
+		userLimiters.lastSweep = time.Now()
+	}
+	l, ok := userLimiters.m[userID]
+	if !ok {
+		l = newRateLimiter(rate, config.Chat.UserBurst)
+		userLimiters.m[userID] = l
+	}
+	userLimiters.Unlock()
+
+	return l.allow()
+}
+
+// validateMessage 检查聊天消息的类型、长度、图片地址和接收者
+func validateMessage(senderID uint, input *InputMessage) error {
+	if input.ReceiverID == 0 {
+		return NewError("invalid_receiver", "缺少接收者")
+	}
+	if input.Type != 1 && input.Type != 2 {
+		return NewError("invalid_type", "不支持的消息类型")
+	}
+	if strings.TrimSpace(input.Content) == "" {
+		return NewError("empty_content", "消息内容不能为空")
+	}
+
+	if input.Type == 1 {
+		if utf8.RuneCountInString(input.Content) > config.Chat.MaxTextLength {
+			return ErrContentTooLong
+		}
+	} else if err := validateImage(senderID, input); err != nil {
+		return err
+	}
+
+	var receiver models.User
+	if err := config.DB.Select("id").First(&receiver, input.ReceiverID).Error; err != nil {
+		return ErrInvalidReceiver
+	}
+	return nil
+}
+
+// validateImage 图片消息只能引用本站的图片：私有附件 (/private/xxx) 须为发送者自己上传的，
+// 公开图片须为商品图片 (聊天中发商品图)，不能引用别人的头像或尚未发布的上传
+// 前端误传签名链接时去掉签名参数，保存的始终是引用地址
+func validateImage(senderID uint, input *InputMessage) error {
+	ref := input.Content
+	private := strings.HasPrefix(ref, config.PrivatePrefix)
+	if private {
+		ref, _, _ = strings.Cut(ref, "?")
+	}
+	if len(ref) > config.Chat.MaxImageURLLen {
+		return ErrInvalidImage
+	}
+
+	var count int64
+	if private {
+		config.DB.Model(&models.Upload{}).Where("url = ? AND private = ? AND user_id = ?", ref, true, senderID).Count(&count)
+	} else {
+		config.DB.Model(&models.ProductImage{}).Where("url = ?", ref).Count(&count)
+		if count == 0 {
+			config.DB.Model(&models.Product{}).Where("image = ?", ref).Count(&count)
+		}
+	}
+	if count == 0 {
+		return ErrInvalidImage
+	}
+	input.Content = ref
+	return nil
+}
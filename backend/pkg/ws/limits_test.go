@@ -0,0 +1,76 @@
+package ws
+
+import (
+	"errors"
+	"gotest/config"
+	"gotest/internal/models"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB 使用内存数据库替换 config.DB
+func useTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.Product{}, &models.ProductImage{}, &models.Upload{}); err != nil {
+		t.Fatal(err)
+	}
+	old := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		sqlDB.Close()
+		config.DB = old
+	})
+}
+
+func TestValidateImage(t *testing.T) {
+	useTestDB(t)
+	config.DB.Create(&[]models.Upload{
+		{UserID: 1, URL: "/private/mine.jpg", StorageKey: "mine.jpg", Private: true},
+		{UserID: 2, URL: "/private/theirs.jpg", StorageKey: "theirs.jpg", Private: true},
+		{UserID: 2, URL: "/uploads/avatar.jpg", StorageKey: "avatar.jpg"},
+		{UserID: 2, URL: "/uploads/listing.jpg", StorageKey: "listing.jpg"},
+		{UserID: 1, URL: "/uploads/unpublished.jpg", StorageKey: "unpublished.jpg"},
+	})
+	product := models.Product{Name: "相机", Price: 100, UserID: 2, Image: "/uploads/cover.jpg"}
+	config.DB.Omit("User").Create(&product)
+	config.DB.Create(&models.ProductImage{ProductID: product.ID, URL: "/uploads/listing.jpg"})
+
+	cases := []struct {
+		content string
+		saved   string // 通过时保存的内容，为空表示应被拒绝
+	}{
+		{"/private/mine.jpg", "/private/mine.jpg"},
+		{"/private/mine.jpg?expires=1&sig=abc", "/private/mine.jpg"},
+		{"/uploads/listing.jpg", "/uploads/listing.jpg"},
+		{"/uploads/cover.jpg", "/uploads/cover.jpg"},
+		{"/private/theirs.jpg", ""},        // 别人的私有附件
+		{"/uploads/avatar.jpg", ""},        // 别人的头像
+		{"/uploads/unpublished.jpg", ""},   // 没有发布到商品的公开上传
+		{"https://evil.example/x.jpg", ""}, // 站外地址
+	}
+	for _, tc := range cases {
+		input := &InputMessage{ReceiverID: 2, Type: 2, Content: tc.content}
+		err := validateImage(1, input)
+		if tc.saved == "" {
+			if !errors.Is(err, ErrInvalidImage) {
+				t.Fatalf("%s: 返回 %v, 期望 ErrInvalidImage", tc.content, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.content, err)
+		}
+		if input.Content != tc.saved {
+			t.Fatalf("%s: 保存为 %q, 期望 %q", tc.content, input.Content, tc.saved)
+		}
+	}
+}
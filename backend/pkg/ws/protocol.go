@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ProtocolVersion 当前协议版本
+// v1 (旧版前端)：上行为 InputMessage，下行聊天消息为裸的 Message JSON、其他事件为 {"event","data"}
+// v2：上下行统一使用 Envelope，连接时带 ?v=2 开启
+const ProtocolVersion = 2
+
+// 帧类型
+const (
+	TypeMessage      = "message"      // 聊天消息 (上行发送 / 下行推送)
+	TypeAck          = "ack"          // 上行：确认收到的最大消息 ID；下行：对客户端帧的确认
+	TypeError        = "error"        // 下行：客户端帧被拒绝
+	TypeRead         = "read"         // 上行：会话已读；下行：已读回执
+	TypeTyping       = "typing"       // 正在输入
+	TypeSync         = "sync"         // 下行：重连补发的消息
+	TypeRecall       = "recall"       // 上行：撤回消息；下行：撤回通知
+	TypeDelete       = "delete"       // 上行：从自己的记录中删除消息；下行：通知自己的其他设备
+	TypeNotification = "notification" // 下行：系统通知
+	TypePing         = "ping"         // 上行：应用层心跳，回 pong
+	TypePong         = "pong"
+)
+
+// Envelope 协议信封
+// ID 由客户端生成，服务端的 ack / error 帧带回同一个 ID，客户端据此去重和匹配请求
+type Envelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Frame 服务端下发的一帧，按连接的协议版本编码
+type Frame struct {
+	Type    string
+	ID      string
+	Payload interface{}
+}
+
+// Error 处理客户端帧失败时返回的错误，会以 error 帧回给客户端
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError 创建协议错误
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// 常用错误码
+var (
+	ErrBadFrame    = NewError("bad_frame", "消息格式错误")
+	ErrUnknownType = NewError("unknown_type", "不支持的消息类型")
+)
+
+// encode 按协议版本编码
+func (f *Frame) encode(version int) ([]byte, error) {
+	if version >= 2 {
+		payload, err := json.Marshal(f.Payload)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(Envelope{V: ProtocolVersion, Type: f.Type, ID: f.ID, Payload: payload})
+	}
+	// v1：聊天消息直接下发 Message，其余沿用 {"event","data"}
+	if f.Type == TypeMessage {
+		return json.Marshal(f.Payload)
+	}
+	return json.Marshal(map[string]interface{}{"event": f.Type, "data": f.Payload})
+}
+
+// decodeEnvelope 解析上行帧，兼容 v1 的 InputMessage
+// v1 帧里的 type 是数字 (消息类型)，event 字段为空表示聊天消息
+func decodeEnvelope(raw []byte) (*Envelope, error) {
+	var probe struct {
+		Type  json.RawMessage `json:"type"`
+		Event string          `json:"event"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return nil, err
+	}
+
+	if len(probe.Type) > 0 && probe.Type[0] == '"' {
+		var env Envelope
+		if err := json.Unmarshal(raw, &env); err != nil {
+			return nil, err
+		}
+		if env.Type == "" {
+			return nil, errors.New("缺少 type")
+		}
+		return &env, nil
+	}
+
+	env := &Envelope{V: 1, Type: probe.Event, Payload: raw}
+	if env.Type == "" {
+		env.Type = TypeMessage
+	}
+	return env, nil
+}
@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"errors"
+	"gotest/config"
+	"gotest/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMessageNotFound = errors.New("消息不存在")
+	ErrNotSender       = errors.New("只能撤回自己发送的消息")
+	ErrRecallExpired   = errors.New("消息发送已超过可撤回时间")
+)
+
+// RecallNotice 撤回通知，推送给会话双方，前端把对应消息替换为占位文字
+type RecallNotice struct {
+	MessageID      uint      `json:"message_id"`
+	ConversationID uint      `json:"conversation_id"`
+	SenderID       uint      `json:"sender_id"`
+	Content        string    `json:"content"`
+	RecalledAt     time.Time `json:"recalled_at"`
+}
+
+// DeleteNotice 删除通知，只推送给删除者自己的其他设备
+type DeleteNotice struct {
+	MessageID      uint `json:"message_id"`
+	ConversationID uint `json:"conversation_id"`
+}
+
+// RecallMessage 发送者在 config.Chat.RecallWindow 内撤回消息：内容替换为占位文字，原内容 (含图片引用) 不再保留
+// 消息是会话最后一条时同步更新会话预览；接收者未读时一并清掉这条未读。重复撤回直接返回
+func (h *Hub) RecallMessage(userID, messageID uint) (*RecallNotice, error) {
+	var msg models.Message
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&msg, messageID).Error; err != nil {
+			return ErrMessageNotFound
+		}
+		if msg.SenderID != userID {
+			return ErrNotSender
+		}
+		if msg.RecalledAt != nil {
+			return nil
+		}
+		if time.Since(msg.CreatedAt) > config.Chat.RecallWindow {
+			return ErrRecallExpired
+		}
+
+		now := time.Now()
+		wasUnread := !msg.IsRead
+		if err := tx.Model(&models.Message{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+			"content":     models.MessageRecalledText,
+			"type":        1,
+			"is_read":     true,
+			"recalled_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		msg.Content, msg.Type, msg.IsRead, msg.RecalledAt = models.MessageRecalledText, 1, true, &now
+
+		if wasUnread {
+			if err := dropUnread(tx, &msg); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Conversation{}).
+			Where("id = ? AND last_message_id = ?", msg.ConversationID, msg.ID).
+			Updates(map[string]interface{}{"last_message": msg.Content, "last_message_type": msg.Type}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notice := &RecallNotice{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		SenderID:       msg.SenderID,
+		Content:        msg.Content,
+		RecalledAt:     *msg.RecalledAt,
+	}
+	h.PushToUser(msg.ReceiverID, TypeRecall, notice)
+	if msg.ReceiverID != msg.SenderID {
+		h.PushToUser(msg.SenderID, TypeRecall, notice)
+	}
+	return notice, nil
+}
+
+// DeleteMessageForUser 把消息从用户自己的聊天记录中删除，对方仍可看到
+// 双方都删除后软删除消息本身；删除的是自己未读的消息时一并清掉未读
+func (h *Hub) DeleteMessageForUser(userID, messageID uint) (*DeleteNotice, error) {
+	var msg models.Message
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&msg, messageID).Error; err != nil {
+			return ErrMessageNotFound
+		}
+		if msg.SenderID != userID && msg.ReceiverID != userID {
+			return ErrMessageNotFound
+		}
+
+		deletion := models.MessageDeletion{UserID: userID, MessageID: msg.ID}
+		if err := tx.Where("user_id = ? AND message_id = ?", userID, msg.ID).FirstOrCreate(&deletion).Error; err != nil {
+			return err
+		}
+
+		if msg.ReceiverID == userID && !msg.IsRead {
+			if err := tx.Model(&models.Message{}).Where("id = ?", msg.ID).Update("is_read", true).Error; err != nil {
+				return err
+			}
+			if err := dropUnread(tx, &msg); err != nil {
+				return err
+			}
+		}
+
+		var deletedBy int64
+		tx.Model(&models.MessageDeletion{}).Where("message_id = ?", msg.ID).Count(&deletedBy)
+		if deletedBy >= 2 || msg.SenderID == msg.ReceiverID {
+			return tx.Delete(&models.Message{}, msg.ID).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notice := &DeleteNotice{MessageID: msg.ID, ConversationID: msg.ConversationID}
+	h.PushToUser(userID, TypeDelete, notice)
+	return notice, nil
+}
+
+// dropUnread 接收者会话未读数减一 (不小于 0)
+func dropUnread(tx *gorm.DB, msg *models.Message) error {
+	if msg.ConversationID == 0 || msg.SenderID == msg.ReceiverID {
+		return nil
+	}
+	var conv models.Conversation
+	if err := tx.First(&conv, msg.ConversationID).Error; err != nil {
+		return nil
+	}
+	col := conv.UnreadColumn(msg.ReceiverID)
+	return tx.Model(&models.Conversation{}).Where("id = ? AND "+col+" > 0", conv.ID).
+		UpdateColumn(col, gorm.Expr(col+" - 1")).Error
+}
+
+// ExcludeDeleted 排除用户自己删除过的消息 (聊天记录、离线同步)
+func ExcludeDeleted(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Where("id NOT IN (SELECT message_id FROM message_deletions WHERE user_id = ?)", userID)
+}
@@ -0,0 +1,110 @@
+package ws
+
+import (
+	"gotest/config"
+	"gotest/internal/models"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// 重连同步一次最多补发的消息数，更早的由前端通过历史消息接口拉取
+const maxSyncMessages = 500
+
+// ReadReceipt 已读回执，推送给会话双方
+// 对方收到后把自己发出的、ID <= LastReadID 的消息标记为已读；自己的其他设备据此清除未读数
+type ReadReceipt struct {
+	ReaderID       uint  `json:"reader_id"`
+	PeerID         uint  `json:"peer_id"`
+	ConversationID uint  `json:"conversation_id,omitempty"` // 为 0 表示与对方的所有会话
+	LastReadID     uint  `json:"last_read_id"`
+	Count          int64 `json:"count"`
+}
+
+// MarkConversationRead 把 peerID 发给 readerID 的未读消息全部标记为已读，清空会话未读数并推送已读回执
+// conversationID 不为 0 时只处理这一个会话 (如只读了关于某商品的聊天)
+func (h *Hub) MarkConversationRead(readerID, peerID, conversationID uint) (*ReadReceipt, error) {
+	receipt := &ReadReceipt{ReaderID: readerID, PeerID: peerID, ConversationID: conversationID}
+
+	unread := config.DB.Model(&models.Message{}).
+		Where("sender_id = ? AND receiver_id = ? AND is_read = ?", peerID, readerID, false)
+	if conversationID > 0 {
+		unread = unread.Where("conversation_id = ?", conversationID)
+	}
+	if err := unread.Session(&gorm.Session{}).Select("COALESCE(MAX(id), 0)").Scan(&receipt.LastReadID).Error; err != nil {
+		return nil, err
+	}
+	if err := markConversationsRead(readerID, peerID, conversationID); err != nil {
+		return nil, err
+	}
+	if receipt.LastReadID == 0 {
+		return receipt, nil
+	}
+
+	result := unread.Where("id <= ?", receipt.LastReadID).Update("is_read", true)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	receipt.Count = result.RowsAffected
+
+	h.PushToUser(peerID, TypeRead, receipt)
+	if peerID != readerID {
+		h.PushToUser(readerID, TypeRead, receipt)
+	}
+	return receipt, nil
+}
+
+// AckMessages 记录用户已确认收到的最大消息 ID (只增不减)，重连时从这里开始补发
+func AckMessages(userID, lastID uint) {
+	config.DB.Model(&models.User{}).
+		Where("id = ? AND last_ack_message_id < ?", userID, lastID).
+		UpdateColumn("last_ack_message_id", lastID)
+}
+
+// syncFrame 生成连接建立后补发错过消息的 sync 帧，没有需要补发的消息时返回 nil
+// c.SyncFrom 为前端确认收到的最后一条消息 ID (为 0 时使用服务端记录的确认位置)；
+// 都没有时只补发未读消息，避免把全部历史重新推一遍
+func (c *Client) syncFrame() *Frame {
+	lastID := c.SyncFrom
+	if lastID == 0 {
+		var user models.User
+		if err := config.DB.Select("last_ack_message_id").First(&user, c.UserID).Error; err == nil {
+			lastID = user.LastAckMessageID
+		}
+	}
+
+	return syncFrameAfter(c.UserID, lastID)
+}
+
+// syncFrameAfter 补发 lastID 之后与用户相关的消息；lastID 为 0 时只补发未读消息
+func syncFrameAfter(userID, lastID uint) *Frame {
+	db := config.DB.Model(&models.Message{})
+	if lastID > 0 {
+		// 包括自己在其他设备上发出的消息
+		db = db.Where("id > ? AND (receiver_id = ? OR sender_id = ?)", lastID, userID, userID)
+	} else {
+		db = db.Where("receiver_id = ? AND is_read = ?", userID, false)
+	}
+
+	db = ExcludeDeleted(db, userID)
+
+	var messages []models.Message
+	if err := db.Order("id asc").Limit(maxSyncMessages + 1).Find(&messages).Error; err != nil {
+		log.Println("WS: 同步离线消息失败:", err)
+		return nil
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	hasMore := len(messages) > maxSyncMessages
+	if hasMore {
+		messages = messages[:maxSyncMessages]
+	}
+	for i := range messages {
+		if messages[i].Type == 2 {
+			messages[i].Content = config.SignedURL(messages[i].Content)
+		}
+	}
+
+	return &Frame{Type: TypeSync, Payload: map[string]interface{}{"messages": messages, "has_more": hasMore}}
+}